@@ -1,5 +1,11 @@
 module github.com/devindford/netlify-dns-zone-file
 
-go 1.18
+go 1.21
 
-require github.com/pelletier/go-toml v1.9.5 // indirect
+require (
+	github.com/pelletier/go-toml v1.9.5
+	golang.org/x/net v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/text v0.13.0 // indirect
@@ -1,248 +1,203 @@
+// Command netlify-dns-zone-file exports the DNS zones of a Netlify account
+// to zone files, see the zonefile package for the library it is built on.
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
-	"net/url"
+	"log/slog"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/pelletier/go-toml"
+	"github.com/devindford/netlify-dns-zone-file/zonefile"
 )
 
-const urlPrefix string = "https://api.netlify.com/api/v1/"
-
-type DnsZone struct {
-	Id   string `json:"id"`
-	Name string `json:"name"`
-}
-
-type DnsRecord struct {
-	Id        string  `json:"id"`
-	DnsZoneId string  `json:"dns_zone_id"`
-	Hostname  string  `json:"hostname"`
-	Type      string  `json:"type"`
-	Ttl       int     `json:"ttl"`
-	Priority  int     `json:"priority"`
-	Weight    *int    `json:"weight,omitempty"`
-	Port      *int    `json:"port,omitempty"`
-	Flag      *string `json:"flag,omitempty"`
-	Tag       *string `json:"tag,omitempty"`
-	Managed   bool    `json:"managed"`
-	Value     string  `json:"value"`
-}
-
-type NetlifyDnsClient struct {
-	client *http.Client
-	token  string
-}
-
-type Redirect struct {
-	From   string `toml:"from"`
-	To     string `toml:"to"`
-	Status int    `toml:"status"`
-	Force  bool   `toml:"force"`
-}
-
-type NetlifyToml struct {
-	Redirects []Redirect `toml:"redirects"`
-}
-
-func readNetlifyToml(filePath string) (NetlifyToml, error) {
-	var config NetlifyToml
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return config, err
-	}
-
-	err = toml.Unmarshal(content, &config)
-	return config, err
-}
-
-func NewNetlifyDnsClient(token string) NetlifyDnsClient {
-	client := &http.Client{}
-
-	return NetlifyDnsClient{client: client, token: token}
-}
-
-func (n *NetlifyDnsClient) addAuthHeader(req *http.Request) {
-	req.Header.Add("Authorization", "Bearer "+n.token)
-}
-
-func (n *NetlifyDnsClient) getReqByteSlice(endpoint string) ([]byte, error) {
-	req, err := http.NewRequest("GET", urlPrefix+endpoint, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating get request: %w", err)
+func main() {
+	opts, err := parseOptions(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	n.addAuthHeader(req)
-
-	resp, err := n.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error doing get request: %w", err)
+		fatal(zonefile.NewLogger(os.Stderr, false, false), zonefile.ExitUsage, err.Error())
 	}
 
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading get request body: %w", err)
+	// Interruptions stop the command between zone files, so none is left
+	// half-written. A second one kills it right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err = zonefile.Run(opts, zonefile.RunEnv{
+		Context:   ctx,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Getenv:    os.Getenv,
+		NewClient: zonefile.NewNetlifyClient,
+	})
+	switch code := zonefile.ExitCode(err); code {
+	case zonefile.ExitOK:
+	case zonefile.ExitDiffer:
+		os.Exit(code)
+	default:
+		fatal(zonefile.NewLogger(os.Stderr, false, false), code, err.Error())
 	}
-
-	return body, nil
 }
 
-func (n *NetlifyDnsClient) GetAllDnsZones() ([]DnsZone, error) {
-	body, err := n.getReqByteSlice("dns_zones")
+// parseOptions turns the arguments of the command, without the program
+// name, into zonefile.Options, writing usage and flag errors to stderr. It
+// returns flag.ErrHelp when help was asked for.
+func parseOptions(args []string, stderr io.Writer) (zonefile.Options, error) {
+	var o zonefile.Options
+	o.TypeTtls = make(map[string]int)
+
+	flags := flag.NewFlagSet("netlify-dns-zone-file", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	flags.BoolVar(&o.Stdout, "stdout", false, "print all zones to standard output instead of writing .zone files")
+	flags.StringVar(&o.OutDir, "out", ".", "directory to write .zone files to")
+	flags.StringVar(&o.FileNaming, "filename", "name", "name zone files after the zone's domain (name) or Netlify ID (id)")
+	flags.Var((*stringList)(&o.Zones), "zone", "only export the named zone, may be repeated or comma-separated")
+	flags.Var((*stringList)(&o.IncludeTypes), "include-type", "only export records of the given type, may be repeated or comma-separated")
+	flags.Var((*stringList)(&o.ExcludeTypes), "exclude-type", "leave out records of the given type, may be repeated or comma-separated, ignored with -include-type")
+	flags.Func("match", "only export records whose hostname matches this regular expression", func(value string) (err error) {
+		o.Match, err = regexp.Compile(value)
+		return err
+	})
+	flags.Func("not-match", "leave out records whose hostname matches this regular expression", func(value string) (err error) {
+		o.NotMatch, err = regexp.Compile(value)
+		return err
+	})
+	flags.StringVar(&o.APIURL, "api-url", zonefile.DefaultAPIURL, "base URL of the Netlify API")
+	flags.StringVar(&o.CacheDir, "cache", "", "save the zones and records fetched from Netlify as JSON in this directory")
+	flags.BoolVar(&o.Offline, "offline", false, "generate zone files from the -cache directory without calling Netlify")
+	flags.Func("since", "only export zones Netlify updated after this RFC 3339 time, best effort and with -cache", func(value string) error {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("%q is not an RFC 3339 time such as 2024-01-02T15:04:05Z", value)
+		}
+		o.Since = since
+		return nil
+	})
+	flags.StringVar(&o.Account, "account", "", "only export the zones of the Netlify team with this slug")
+	flags.IntVar(&o.Concurrency, "concurrency", zonefile.DefaultConcurrency, "number of zones to fetch records for at the same time")
+	flags.DurationVar(&o.Timeout, "timeout", zonefile.DefaultTimeout, "timeout for each Netlify API request")
+	maxRecords := flags.Int("max-records", zonefile.DefaultMaxRecords, "fail when a zone has more records than this, 0 for no limit")
+	flags.IntVar(&o.Retries, "retries", zonefile.DefaultMaxAttempts, "maximum attempts for each Netlify API request")
+	flags.BoolVar(&o.Gzip, "gzip", false, "compress output files with gzip, adding .gz to their names")
+	flags.BoolVar(&o.DryRun, "dry-run", false, "report the files that would be written on stderr without writing them")
+	flags.StringVar(&o.Format, "format", zonefile.FormatBind, "output format: bind, cloudflare, json, yaml, route53, csv or managed-report")
+	flags.StringVar(&o.SingleFile, "single-file", "", "write every zone to this one file, each section starting with its own header and $ORIGIN")
+	flags.StringVar(&o.DiffPath, "diff", "", "compare the generated zone file with this file, print the differences and exit non-zero if there are any")
+	flags.BoolVar(&o.Strict, "strict", false, "refuse to write zone files that fail validation or hold records with invalid hostnames, instead of skipping those records")
+	flags.BoolVar(&o.Check, "check", false, "run named-checkzone on every zone file when it is installed, failing on the zones it rejects")
+	flags.StringVar(&o.Token, "token", "", "Netlify personal access token, takes precedence over -token-file and NETLIFY_TOKEN")
+	flags.StringVar(&o.TokenFile, "token-file", "", "file containing the Netlify personal access token")
+	flags.BoolVar(&o.UseCLIAuth, "use-cli-auth", false, "fall back to the token of the user logged in to the Netlify CLI")
+	// The redirect files are only required to exist when named explicitly,
+	// so their defaults are left empty
+	flags.Var((*stringList)(&o.TomlPaths), "toml", "path to a netlify.toml to read redirects from, may be repeated with later files taking precedence (default netlify.toml)")
+	flags.StringVar(&o.RedirectsPath, "redirects", "", "path to the _redirects file to read redirects from (default _redirects)")
+	flags.BoolVar(&o.UnicodeComments, "unicode-comments", false, "follow internationalized names converted to punycode with a comment holding their Unicode form")
+	flags.StringVar(&o.ApplyPath, "apply", "", "change the Netlify zone named by this zone file's $ORIGIN to match it, with -dry-run only printing the plan")
+	flags.BoolVar(&o.Confirm, "confirm", false, "allow -apply to delete more records than -delete-threshold")
+	deleteThreshold := flags.Int("delete-threshold", zonefile.DefaultDeleteThreshold, "number of records -apply may delete without -confirm")
+	flags.IntVar(&o.Ttl, "ttl", 0, "replace the TTL of every record with this many seconds")
+	flags.Var(ttlOverrides(o.TypeTtls), "ttl-type", "replace the TTL of records of one type, as TYPE=SECONDS, may be repeated and takes precedence over -ttl")
+	flags.StringVar(&o.Class, "class", "IN", "class of every record: IN, CH, HS or CS")
+	flags.StringVar(&o.LineEnding, "line-ending", zonefile.LineEndingLF, "line endings of zone files: lf or crlf")
+	flags.BoolVar(&o.NoTimestamp, "no-timestamp", false, "leave the generation time out of zone file headers so output only changes with the records")
+	flags.BoolVar(&o.AnnotateNetlify, "annotate-netlify", false, "end the lines of NETLIFY and NETLIFYv6 records, written as CNAME records, with a netlify-managed comment naming their original type")
+	flags.BoolVar(&o.AnnotateIds, "annotate-ids", false, "end each record line with an id= comment holding its Netlify record ID")
+	flags.BoolVar(&o.SkipManaged, "skip-managed", false, "leave out records managed by Netlify, including all NETLIFY and NETLIFYv6 records")
+	flags.BoolVar(&o.FlattenAliases, "flatten-alias", false, "replace apex NETLIFY and NETLIFYv6 records with the A and AAAA records their targets resolve to")
+	flags.BoolVar(&o.FailOnEmpty, "fail-empty", false, "exit with an error when a zone has no records, after still writing its zone file")
+	flags.BoolVar(&o.FailFast, "fail-fast", false, "stop at the first zone that fails instead of exporting the others and reporting all failures at the end")
+	flags.BoolVar(&o.ShowVersion, "version", false, "print the version of the tool and exit")
+	flags.BoolVar(&o.Verbose, "v", false, "log debug messages, such as retried requests and applied redirects")
+	flags.BoolVar(&o.Quiet, "q", false, "only log errors")
+	flags.StringVar(&o.MetricsPath, "metrics-file", "", "write Prometheus metrics about the export to this file, for the node exporter's textfile collector")
+	flags.BoolVar(&o.Progress, "progress", false, "report each zone on stderr as its records are fetched, ignored with -q")
+	err := flags.Parse(args)
 	if err != nil {
-		return nil, err
+		return zonefile.Options{}, err
 	}
 
-	var dnsZones []DnsZone
-	err = json.Unmarshal(body, &dnsZones)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling get request body: %w", err)
+	// 0 disables the cap and allows no deletions on the command line, which
+	// Options spells as a negative value
+	if *maxRecords < 0 {
+		return zonefile.Options{}, fmt.Errorf("-max-records must not be negative, got %d", *maxRecords)
 	}
-
-	return dnsZones, nil
-}
-
-func (n *NetlifyDnsClient) GetAllDnsRecords(zoneId string) ([]DnsRecord, error) {
-	body, err := n.getReqByteSlice("dns_zones/" + zoneId + "/dns_records")
-	if err != nil {
-		return nil, err
+	o.MaxRecords = *maxRecords
+	if o.MaxRecords == 0 {
+		o.MaxRecords = -1
 	}
-
-	var records []DnsRecord
-	err = json.Unmarshal(body, &records)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling get request body: %w", err)
+	o.DeleteThreshold = *deleteThreshold
+	if o.DeleteThreshold == 0 {
+		o.DeleteThreshold = -1
 	}
-
-	return records, nil
+	return o, nil
 }
 
-func GenerateZoneFile(zone DnsZone, records []DnsRecord, redirects []Redirect) (string, error) {
-	var zoneFile strings.Builder
-
-	zoneFile.WriteString(fmt.Sprintf("$ORIGIN %s\n", zone.Name+"."))
+// stringList is a flag.Value collecting repeated and comma-separated values
+type stringList []string
 
-	// Create a map to track processed record names
-	processedNames := make(map[string]bool)
-
-	for _, record := range records {
-		name := record.Hostname + "."
-
-		// Check if this record name has been processed
-		if _, exists := processedNames[name]; exists {
-			fmt.Printf("Ignoring duplicate record name: %s\n", record.Hostname)
-			continue
-		}
-
-		// Now mark this record name as processed
-		processedNames[name] = true
-
-		var value string
-		if record.Type == "CNAME" || record.Type == "NETLIFYv6" || record.Type == "NETLIFY" {
-			value = record.Value + "."
-		} else {
-			value = record.Value
-		}
-
-		var priority = ""
-		if record.Priority != 0 {
-			priority = fmt.Sprintf("\t%d", record.Priority)
-		}
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
-		for _, redirect := range redirects {
-			if matchRedirectRule(record.Hostname, redirect.From) {
-				value = extractDestination(redirect.To)
-				fmt.Printf("redirect: %s", redirect.To)
-				break
-			}
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			*l = append(*l, item)
 		}
-
-		zoneFile.WriteString(
-			fmt.Sprintf(
-				"%s\tIN\t%d\t%s%s\t%s\n",
-				name,
-				record.Ttl,
-				typeWithReplacement(record.Type),
-				priority,
-				value,
-			),
-		)
 	}
-
-	return zoneFile.String(), nil
+	return nil
 }
 
-func typeWithReplacement(recordType string) string {
-	if recordType == "NETLIFY" || recordType == "NETLIFYv6" {
-		return "CNAME"
-	}
-	return recordType
-}
+// ttlOverrides is a flag.Value collecting repeated TYPE=SECONDS overrides
+type ttlOverrides map[string]int
 
-// Checks if the domain name matches the "from" part of the redirect rule
-func matchRedirectRule(domain, fromRule string) bool {
-	parsedURL, err := url.Parse(fromRule)
-	if err != nil {
-		// Handle error or log it
-		return false
+func (o ttlOverrides) String() string {
+	var overrides []string
+	for recordType, ttl := range o {
+		overrides = append(overrides, fmt.Sprintf("%s=%d", recordType, ttl))
 	}
-	return domain == parsedURL.Host
-}
-
-// Extracts the destination URL from the "to" part of the redirect rule
-// and removes any :splat from the URL since it will be handled at the app level
-func extractDestination(toRule string) string {
-	// Remove :splat or any other placeholder from the URL
-	cleanedURL := strings.ReplaceAll(toRule, ":splat", "")
-
-	// Optionally, you might want to clean up URLs that end with a slash as a result of removing :splat
-	cleanedURL = strings.TrimRight(cleanedURL, "/")
-
-	return cleanedURL
+	sort.Strings(overrides)
+	return strings.Join(overrides, ",")
 }
 
-func main() {
-	token := os.Getenv("NETLIFY_TOKEN")
-
-	if token == "" {
-		log.Fatalln("NETLIFY_TOKEN was not set.")
+func (o ttlOverrides) Set(value string) error {
+	recordType, seconds, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("%q is not of the form TYPE=SECONDS", value)
 	}
 
-	client := NewNetlifyDnsClient(token)
-
-	zones, err := client.GetAllDnsZones()
+	ttl, err := strconv.Atoi(seconds)
+	if err != nil || ttl <= 0 {
+		return fmt.Errorf("TTL %q for %s must be a positive number of seconds", seconds, recordType)
+	}
+	canonical, err := zonefile.ParseRecordType(recordType)
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
-	for _, zone := range zones {
-		records, err := client.GetAllDnsRecords(zone.Id)
-		if err != nil {
-			log.Fatalln(err)
-		}
-
-		tomlConfig, err := readNetlifyToml("netlify.toml")
-		if err != nil {
-			log.Fatalf("Failed to read netlify.toml: %v", err)
-		}
-
-		zoneContents, err := GenerateZoneFile(zone, records, tomlConfig.Redirects)
-		if err != nil {
-			log.Fatalln(err)
-		}
-
-		fileName := zone.Id + ".zone"
-
-		err = os.WriteFile(fileName, []byte(zoneContents), 0644)
-		if err != nil {
-			log.Fatalln(err)
-		}
+	o[canonical] = ttl
+	return nil
+}
 
-		fmt.Println(fileName)
-	}
+// fatal logs msg at error level and exits with status code
+func fatal(logger *slog.Logger, code int, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(code)
 }
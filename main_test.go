@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestParseOptionsSpellsTtlTypesAsNetlify(t *testing.T) {
+	opts, err := parseOptions([]string{"-ttl-type", "NETLIFYv6=60", "-ttl-type", "mx=300"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"NETLIFYv6": 60, "MX": 300}
+	if len(opts.TypeTtls) != len(want) {
+		t.Fatalf("got TTL overrides %v, want %v", opts.TypeTtls, want)
+	}
+	for recordType, ttl := range want {
+		if opts.TypeTtls[recordType] != ttl {
+			t.Errorf("got TTL overrides %v, want %v", opts.TypeTtls, want)
+		}
+	}
+}
+
+func TestParseOptionsRejectsUnknownTtlTypes(t *testing.T) {
+	if _, err := parseOptions([]string{"-ttl-type", "BOGUS=60"}, io.Discard); err == nil {
+		t.Error("expected an error for an unknown record type")
+	}
+}
+
+func TestParseOptionsCompilesHostnamePatterns(t *testing.T) {
+	opts, err := parseOptions([]string{"-match", `^www\.`, "-not-match", "staging"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Match == nil || !opts.Match.MatchString("www.example.com") || opts.NotMatch == nil || !opts.NotMatch.MatchString("staging.example.com") {
+		t.Errorf("got patterns %v and %v, want both compiled", opts.Match, opts.NotMatch)
+	}
+
+	if _, err := parseOptions([]string{"-match", "(www"}, io.Discard); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
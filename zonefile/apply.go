@@ -0,0 +1,241 @@
+package zonefile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ZoneApplier is a ZoneFetcher that can also change the records of a zone,
+// which the apply mode needs. NetlifyDnsClient implements it.
+type ZoneApplier interface {
+	ZoneFetcher
+	CreateDnsRecord(ctx context.Context, zoneId string, record DnsRecord) (DnsRecord, error)
+	DeleteDnsRecord(ctx context.Context, zoneId, recordId string) error
+}
+
+var _ ZoneApplier = (*NetlifyDnsClient)(nil)
+
+// DefaultDeleteThreshold is the number of deletions an apply may make
+// without -confirm
+const DefaultDeleteThreshold = 5
+
+// applyOptions controls applyZoneFile
+type applyOptions struct {
+	DryRun bool
+	// Confirm allows a plan to delete more than DeleteThreshold records
+	Confirm         bool
+	DeleteThreshold int
+}
+
+// recordUpdate replaces a live record by one that only differs in TTL.
+// Netlify cannot edit records in place, so it is applied as a create
+// followed by a delete.
+type recordUpdate struct {
+	From, To DnsRecord
+}
+
+// changePlan lists the changes that converge a zone to a zone file
+type changePlan struct {
+	Create []DnsRecord
+	Update []recordUpdate
+	Delete []DnsRecord
+}
+
+func (p changePlan) empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// deletions counts the records the plan removes without replacing them
+func (p changePlan) deletions() int {
+	return len(p.Delete)
+}
+
+// applyZoneFile converges the Netlify zone whose name is the $ORIGIN of the
+// zone file at path to the records in that file, writing the plan to out
+func applyZoneFile(ctx context.Context, client ZoneApplier, path string, opts applyOptions, out io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	origin, desired, err := parseZone(file)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if origin == "" {
+		return fmt.Errorf("%s has no $ORIGIN naming the zone to apply it to", path)
+	}
+
+	zones, err := client.GetAllDnsZones(ctx)
+	if err != nil {
+		return err
+	}
+	matching, err := filterZones(zones, []string{origin})
+	if err != nil {
+		return err
+	}
+	zone := matching[0]
+
+	live, err := client.GetAllDnsRecords(ctx, zone.Id)
+	if err != nil {
+		return err
+	}
+
+	plan := planChanges(zone, live, desired)
+	writePlan(out, zone, plan)
+	if plan.empty() || opts.DryRun {
+		return nil
+	}
+
+	if plan.deletions() > opts.DeleteThreshold && !opts.Confirm {
+		return fmt.Errorf("refusing to delete %d records from %s without -confirm", plan.deletions(), zone.Name)
+	}
+
+	for _, record := range plan.Create {
+		if _, err := client.CreateDnsRecord(ctx, zone.Id, record); err != nil {
+			return fmt.Errorf("error creating %s: %w", describeRecord(record), err)
+		}
+	}
+	for _, update := range plan.Update {
+		if _, err := client.CreateDnsRecord(ctx, zone.Id, update.To); err != nil {
+			return fmt.Errorf("error creating %s: %w", describeRecord(update.To), err)
+		}
+		if err := client.DeleteDnsRecord(ctx, zone.Id, update.From.Id); err != nil {
+			return fmt.Errorf("error deleting %s: %w", describeRecord(update.From), err)
+		}
+	}
+	for _, record := range plan.Delete {
+		if err := client.DeleteDnsRecord(ctx, zone.Id, record.Id); err != nil {
+			return fmt.Errorf("error deleting %s: %w", describeRecord(record), err)
+		}
+	}
+
+	fmt.Fprintf(out, "applied %d change(s) to %s\n", len(plan.Create)+len(plan.Update)+len(plan.Delete), zone.Name)
+	return nil
+}
+
+// planChanges compares the live records of a zone with the desired ones.
+// Records Netlify manages itself, NETLIFY pseudo-records and apex NS
+// records are never created or deleted, and desired records that match
+// what they render to are left alone.
+func planChanges(zone DnsZone, live, desired []DnsRecord) changePlan {
+	var plan changePlan
+
+	unmatched := make(map[string][]DnsRecord)
+	protected := make(map[string]bool)
+	for _, record := range live {
+		if isProtectedRecord(zone, record) {
+			rendered := record
+			rendered.Type = typeWithReplacement(record.Type)
+			protected[recordIdentity(rendered)] = true
+			continue
+		}
+		unmatched[recordIdentity(record)] = append(unmatched[recordIdentity(record)], record)
+	}
+
+	for _, record := range desired {
+		identity := recordIdentity(record)
+		if protected[identity] || isProtectedRecord(zone, record) {
+			continue
+		}
+
+		candidates := unmatched[identity]
+		if len(candidates) == 0 {
+			plan.Create = append(plan.Create, record)
+			continue
+		}
+
+		match := -1
+		for i, candidate := range candidates {
+			if candidate.Ttl == record.Ttl {
+				match = i
+				break
+			}
+		}
+		if match == -1 {
+			plan.Update = append(plan.Update, recordUpdate{From: candidates[0], To: record})
+			match = 0
+		}
+		unmatched[identity] = append(candidates[:match:match], candidates[match+1:]...)
+	}
+
+	stale := make(map[string]bool)
+	for _, records := range unmatched {
+		for _, record := range records {
+			stale[record.Id] = true
+		}
+	}
+	for _, record := range sortRecords(live, zone.Name) {
+		if stale[record.Id] {
+			plan.Delete = append(plan.Delete, record)
+		}
+	}
+
+	return plan
+}
+
+// isProtectedRecord reports whether record is maintained by Netlify and so
+// left out of apply plans
+func isProtectedRecord(zone DnsZone, record DnsRecord) bool {
+	if record.Managed || record.Type == "NETLIFY" || record.Type == "NETLIFYv6" {
+		return true
+	}
+	return record.Type == "NS" && normalizeZoneName(record.Hostname) == normalizeZoneName(zone.Name)
+}
+
+// recordIdentity identifies a record by everything but its ID and TTL, in a
+// form where Netlify's and parsed records compare equal
+func recordIdentity(record DnsRecord) string {
+	value := record.Value
+	switch record.Type {
+	case "CNAME", "MX", "NS", "PTR", "SRV":
+		value = normalizeZoneName(value)
+	}
+
+	parts := []string{normalizeZoneName(record.Hostname), record.Type, value}
+	switch record.Type {
+	case "MX":
+		parts = append(parts, fmt.Sprint(record.Priority))
+	case "SRV":
+		parts = append(parts, fmt.Sprint(record.Priority), fmt.Sprint(intOrZero(record.Weight)), fmt.Sprint(intOrZero(record.Port)))
+	case "CAA":
+		parts = append(parts, stringOrEmpty(record.Flag), stringOrEmpty(record.Tag))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// describeRecord formats a record for plan output and errors
+func describeRecord(record DnsRecord) string {
+	data := strings.ReplaceAll(recordData(record, record.Value), "\t", " ")
+	return fmt.Sprintf("%s %d %s %s", record.Hostname, record.Ttl, record.Type, data)
+}
+
+// writePlan prints the changes of a plan, one per line
+func writePlan(out io.Writer, zone DnsZone, plan changePlan) {
+	if plan.empty() {
+		fmt.Fprintf(out, "%s is up to date\n", zone.Name)
+		return
+	}
+
+	fmt.Fprintf(out, "plan for %s:\n", zone.Name)
+	for _, record := range plan.Create {
+		fmt.Fprintf(out, "+ %s\n", describeRecord(record))
+	}
+	for _, update := range plan.Update {
+		fmt.Fprintf(out, "~ %s (ttl %d -> %d)\n", describeRecord(update.To), update.From.Ttl, update.To.Ttl)
+	}
+	for _, record := range plan.Delete {
+		fmt.Fprintf(out, "- %s\n", describeRecord(record))
+	}
+}
@@ -0,0 +1,127 @@
+package zonefile
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// liveRecords describes the records of a zone of fetcher, sorted
+func liveRecords(fetcher *MemoryZoneFetcher, zoneId string) []string {
+	var described []string
+	for _, record := range fetcher.Records[zoneId] {
+		described = append(described, describeRecord(record))
+	}
+	sort.Strings(described)
+	return described
+}
+
+func TestApplyZoneFile(t *testing.T) {
+	live := []DnsRecord{
+		{Id: "r1", Hostname: "example.com", Type: "NS", Value: "dns1.p01.nsone.net", Ttl: 3600},
+		{Id: "r2", Hostname: "www.example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+		{Id: "r3", Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+		{Id: "r4", Hostname: "old.example.com", Type: "A", Value: "192.0.2.4", Ttl: 3600},
+	}
+	header := "$ORIGIN example.com.\n$TTL 3600\n@\tIN\tNS\tdns1.p01.nsone.net.\nwww\tIN\tCNAME\texample.netlify.app.\n"
+
+	tests := []struct {
+		name     string
+		zoneFile string
+		plan     []string
+		want     []string
+	}{
+		{
+			"add only",
+			header + "@\tIN\tA\t192.0.2.1\nold\tIN\tA\t192.0.2.4\nnew\tIN\tA\t192.0.2.5\n",
+			[]string{"+ new.example.com 3600 A 192.0.2.5"},
+			[]string{
+				"example.com 3600 A 192.0.2.1",
+				"example.com 3600 NS dns1.p01.nsone.net.",
+				"new.example.com 3600 A 192.0.2.5",
+				"old.example.com 3600 A 192.0.2.4",
+				"www.example.com 3600 NETLIFY example.netlify.app.",
+			},
+		},
+		{
+			"delete only",
+			header + "@\tIN\tA\t192.0.2.1\n",
+			[]string{"- old.example.com 3600 A 192.0.2.4"},
+			[]string{
+				"example.com 3600 A 192.0.2.1",
+				"example.com 3600 NS dns1.p01.nsone.net.",
+				"www.example.com 3600 NETLIFY example.netlify.app.",
+			},
+		},
+		{
+			"mixed",
+			header + "@\tIN\t300\tA\t192.0.2.1\nnew\tIN\tA\t192.0.2.5\n",
+			[]string{
+				"+ new.example.com 3600 A 192.0.2.5",
+				"~ example.com 300 A 192.0.2.1 (ttl 3600 -> 300)",
+				"- old.example.com 3600 A 192.0.2.4",
+			},
+			[]string{
+				"example.com 300 A 192.0.2.1",
+				"example.com 3600 NS dns1.p01.nsone.net.",
+				"new.example.com 3600 A 192.0.2.5",
+				"www.example.com 3600 NETLIFY example.netlify.app.",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetcher := &MemoryZoneFetcher{
+				Zones:   []DnsZone{{Id: "z1", Name: "example.com"}},
+				Records: map[string][]DnsRecord{"z1": append([]DnsRecord(nil), live...)},
+			}
+			path := filepath.Join(t.TempDir(), "example.com.zone")
+			if err := os.WriteFile(path, []byte(test.zoneFile), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			err := applyZoneFile(context.Background(), fetcher, path, applyOptions{DeleteThreshold: DefaultDeleteThreshold}, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, line := range test.plan {
+				if !strings.Contains(out.String(), line+"\n") {
+					t.Errorf("plan does not hold %q:\n%s", line, out.String())
+				}
+			}
+			if got := liveRecords(fetcher, "z1"); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got live records %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyZoneFileRefusesManyDeletions(t *testing.T) {
+	fetcher := &MemoryZoneFetcher{
+		Zones: []DnsZone{{Id: "z1", Name: "example.com"}},
+		Records: map[string][]DnsRecord{"z1": {
+			{Id: "r1", Hostname: "a.example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+			{Id: "r2", Hostname: "b.example.com", Type: "A", Value: "192.0.2.2", Ttl: 3600},
+		}},
+	}
+	path := filepath.Join(t.TempDir(), "example.com.zone")
+	if err := os.WriteFile(path, []byte("$ORIGIN example.com.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := applyZoneFile(context.Background(), fetcher, path, applyOptions{DeleteThreshold: 1}, &out)
+	if err == nil || !strings.Contains(err.Error(), "-confirm") {
+		t.Errorf("got error %v, want a refusal without -confirm", err)
+	}
+	if len(fetcher.Records["z1"]) != 2 {
+		t.Errorf("got %d records left, want both", len(fetcher.Records["z1"]))
+	}
+}
@@ -0,0 +1,93 @@
+package zonefile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cachedFetcher is a ZoneFetcher saving the zones and records client returns
+// to dir as JSON, or serving them from dir alone when client is nil, so zone
+// files can be regenerated offline
+type cachedFetcher struct {
+	client ZoneFetcher
+	dir    string
+	logger *slog.Logger
+}
+
+var _ ZoneFetcher = (*cachedFetcher)(nil)
+
+func newCachedFetcher(client ZoneFetcher, dir string, logger *slog.Logger) (*cachedFetcher, error) {
+	if client != nil {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("error creating cache directory: %w", err)
+		}
+	}
+	return &cachedFetcher{client: client, dir: dir, logger: logger}, nil
+}
+
+func (c *cachedFetcher) GetAllDnsZones(ctx context.Context) ([]DnsZone, error) {
+	path := filepath.Join(c.dir, "zones.json")
+
+	var zones []DnsZone
+	if c.client == nil {
+		return zones, c.read(path, &zones)
+	}
+
+	zones, err := c.client.GetAllDnsZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return zones, c.write(path, zones)
+}
+
+func (c *cachedFetcher) GetAllDnsRecords(ctx context.Context, zoneId string) ([]DnsRecord, error) {
+	path := filepath.Join(c.dir, "records-"+sanitizeFileName(zoneId)+".json")
+
+	var records []DnsRecord
+	if c.client == nil {
+		return records, c.read(path, &records)
+	}
+
+	records, err := c.client.GetAllDnsRecords(ctx, zoneId)
+	if err != nil {
+		return nil, err
+	}
+	return records, c.write(path, records)
+}
+
+func (c *cachedFetcher) read(path string, v any) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading cache, run once without -offline to fill it: %w", err)
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		c.logger.Debug("using cached response", "file", path, "age", time.Since(info.ModTime()).Round(time.Second))
+	}
+
+	err = json.Unmarshal(content, v)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling cached %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *cachedFetcher) write(path string, v any) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling cached %s: %w", path, err)
+	}
+
+	err = os.WriteFile(path, content, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+	c.logger.Debug("cached response", "file", path)
+	return nil
+}
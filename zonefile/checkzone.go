@@ -0,0 +1,45 @@
+package zonefile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// namedCheckzone is the BIND tool -check runs on zone files
+const namedCheckzone = "named-checkzone"
+
+// checkZoneFile runs the named-checkzone at path on the contents of the zone
+// file of zoneName, returning its output. The contents go through a
+// temporary file so zones can be checked before they are written, or when
+// they never are. An error is returned when the tool rejects the zone.
+func checkZoneFile(ctx context.Context, path, zoneName, contents string) (string, error) {
+	file, err := os.CreateTemp("", "netlify-zone-*.zone")
+	if err != nil {
+		return "", fmt.Errorf("error creating file for %s: %w", namedCheckzone, err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(contents)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("error writing file for %s: %w", namedCheckzone, err)
+	}
+
+	output, err := exec.CommandContext(ctx, path, normalizeZoneName(zoneName), file.Name()).CombinedOutput()
+	report := strings.TrimSpace(string(output))
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return report, fmt.Errorf("%s rejected %s: %s", namedCheckzone, zoneName, report)
+	}
+	if err != nil {
+		return report, fmt.Errorf("error running %s: %w", namedCheckzone, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,69 @@
+package zonefile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// netlifyCLIConfig is the part of the Netlify CLI's config.json holding the
+// access tokens of the users logged in with netlify login
+type netlifyCLIConfig struct {
+	UserId string `json:"userId"`
+	Users  map[string]struct {
+		Auth struct {
+			Token string `json:"token"`
+		} `json:"auth"`
+	} `json:"users"`
+}
+
+// netlifyCLIConfigPaths returns the locations the Netlify CLI keeps its
+// config.json in on this platform, most recent layout first
+func netlifyCLIConfigPaths(getenv func(string) string) []string {
+	home := getenv("HOME")
+	var paths []string
+	switch runtime.GOOS {
+	case "darwin":
+		paths = append(paths, filepath.Join(home, "Library", "Preferences", "netlify", "config.json"))
+	case "windows":
+		paths = append(paths, filepath.Join(getenv("APPDATA"), "netlify", "Config", "config.json"))
+		home = getenv("USERPROFILE")
+	default:
+		configHome := getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		paths = append(paths, filepath.Join(configHome, "netlify", "config.json"))
+	}
+	return append(paths, filepath.Join(home, ".netlify", "config.json"))
+}
+
+// netlifyCLIToken returns the access token of the user currently logged in
+// to the Netlify CLI
+func netlifyCLIToken(getenv func(string) string) (string, error) {
+	for _, path := range netlifyCLIConfigPaths(getenv) {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading Netlify CLI config: %w", err)
+		}
+
+		var config netlifyCLIConfig
+		err = json.Unmarshal(content, &config)
+		if err != nil {
+			return "", fmt.Errorf("error unmarshalling Netlify CLI config %s: %w", path, err)
+		}
+
+		token := config.Users[config.UserId].Auth.Token
+		if token == "" {
+			return "", fmt.Errorf("no user is logged in to the Netlify CLI in %s, run netlify login", path)
+		}
+		return token, nil
+	}
+	return "", errors.New("no Netlify CLI config found, run netlify login")
+}
@@ -0,0 +1,68 @@
+package zonefile
+
+import (
+	"sort"
+	"strings"
+)
+
+// normalizeZoneLines reduces a zone file to a sorted list of its directives
+// and records with comments, blank lines and the SOA removed, whitespace
+// collapsed and names lowercased, so files that only differ in layout,
+// order or serial compare equal
+func normalizeZoneLines(contents string) []string {
+	var lines []string
+	for _, line := range strings.Split(contents, "\n") {
+		fields, err := splitZoneLine(line)
+		if err != nil || len(fields) == 0 {
+			if err != nil {
+				lines = append(lines, strings.TrimSpace(line))
+			}
+			continue
+		}
+
+		isSOA := false
+		for i, field := range fields {
+			if !strings.HasPrefix(field, `"`) {
+				fields[i] = strings.ToLower(field)
+			}
+			isSOA = isSOA || fields[i] == "soa"
+		}
+		if isSOA {
+			continue
+		}
+
+		lines = append(lines, strings.Join(fields, " "))
+	}
+
+	sort.Strings(lines)
+	return lines
+}
+
+// diffZoneFiles compares two zone files after normalizing them and returns
+// the lines only found in the old file prefixed with "-" followed by those
+// only found in the new file prefixed with "+"
+func diffZoneFiles(oldContents, newContents string) []string {
+	remaining := make(map[string]int)
+	for _, line := range normalizeZoneLines(newContents) {
+		remaining[line]++
+	}
+
+	var removed []string
+	for _, line := range normalizeZoneLines(oldContents) {
+		if remaining[line] > 0 {
+			remaining[line]--
+			continue
+		}
+		removed = append(removed, "- "+line)
+	}
+
+	var added []string
+	for _, line := range normalizeZoneLines(newContents) {
+		if remaining[line] > 0 {
+			remaining[line]--
+			added = append(added, "+ "+line)
+		}
+	}
+
+	return append(removed, added...)
+}
@@ -0,0 +1,80 @@
+package zonefile_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/devindford/netlify-dns-zone-file/zonefile"
+)
+
+// fetcher serves the zones the examples export, as Netlify would
+func fetcher() *zonefile.MemoryZoneFetcher {
+	return &zonefile.MemoryZoneFetcher{
+		Zones: []zonefile.DnsZone{{Id: "z1", Name: "example.com"}, {Id: "z2", Name: "example.org"}},
+		Records: map[string][]zonefile.DnsRecord{
+			"z1": {
+				{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+				{Hostname: "www.example.com", Type: "CNAME", Value: "example.com", Ttl: 3600},
+			},
+			"z2": {{Hostname: "example.org", Type: "A", Value: "192.0.2.2", Ttl: 3600}},
+		},
+	}
+}
+
+// recordLines prints the lines of a zone file holding records other than
+// the SOA
+func recordLines(zoneFile string) {
+	for _, line := range strings.Split(zoneFile, "\n") {
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "$") || strings.Contains(line, "\tSOA\t") {
+			continue
+		}
+		fmt.Println(line)
+	}
+}
+
+func ExampleExportZones() {
+	zoneFiles, err := zonefile.ExportZones(context.Background(), fetcher(), zonefile.ExportOptions{Zones: []string{"example.com"}})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var names []string
+	for name := range zoneFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+		recordLines(zoneFiles[name])
+	}
+	// Output:
+	// example.com
+	// @	IN	A	192.0.2.1
+	// www	IN	CNAME	example.com.
+}
+
+func ExampleRun() {
+	var stdout bytes.Buffer
+	err := zonefile.Run(zonefile.Options{Token: "token", Stdout: true, NoTimestamp: true, Quiet: true}, zonefile.RunEnv{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		Getenv: func(string) string { return "" },
+		NewClient: func(token string, opts ...zonefile.ClientOption) zonefile.ZoneApplier {
+			return fetcher()
+		},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	recordLines(stdout.String())
+	// Output:
+	// @	IN	A	192.0.2.1
+	// www	IN	CNAME	example.com.
+	// @	IN	A	192.0.2.2
+}
@@ -0,0 +1,66 @@
+package zonefile
+
+import "errors"
+
+// Exit codes of the command, documented in the README for CI pipelines
+const (
+	ExitOK = 0
+	// ExitDiffer is returned in -diff mode when the zone files differ
+	ExitDiffer = 1
+	// ExitUsage is returned for invalid or conflicting options
+	ExitUsage = 2
+	// ExitFailure is returned when zones could not be fetched, applied or
+	// written, including when only some of them failed
+	ExitFailure = 3
+	// ExitInvalid is returned when every failure was a zone refused for
+	// its contents, such as under -strict
+	ExitInvalid = 4
+)
+
+// usageError is returned by Run for options that are invalid or conflict
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// validationError is returned for zones whose records cannot be written as
+// a valid zone file, so they can be told apart from failures to fetch or
+// write them
+type validationError struct {
+	err error
+}
+
+func (e validationError) Error() string { return e.err.Error() }
+func (e validationError) Unwrap() error { return e.err }
+
+// ExitCode maps the error returned by Run to the exit code of the command
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, errZonesDiffer):
+		return ExitDiffer
+	case errors.As(err, new(usageError)):
+		return ExitUsage
+	case onlyValidationErrors(err):
+		return ExitInvalid
+	}
+	return ExitFailure
+}
+
+// onlyValidationErrors reports whether err, and each error joined into it,
+// is a validationError
+func onlyValidationErrors(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		for _, err := range errs {
+			if !onlyValidationErrors(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	return errors.As(err, new(validationError))
+}
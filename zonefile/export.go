@@ -0,0 +1,417 @@
+package zonefile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConcurrency is the number of zones fetched at the same time when
+// ExportOptions.Concurrency is unset
+const DefaultConcurrency = 4
+
+// ZoneFetcher is the source of zones and records that ExportZones works
+// from. NetlifyDnsClient implements it on top of the Netlify API.
+type ZoneFetcher interface {
+	GetAllDnsZones(ctx context.Context) ([]DnsZone, error)
+	GetAllDnsRecords(ctx context.Context, zoneId string) ([]DnsRecord, error)
+}
+
+var _ ZoneFetcher = (*NetlifyDnsClient)(nil)
+
+// ExportOptions controls which zones ExportZones exports and how
+type ExportOptions struct {
+	// Zones restricts the export to the named zones, every zone in the
+	// account is exported when it is empty
+	Zones       []string
+	Redirects   []Redirect
+	ZoneOptions ZoneOptions
+	Concurrency int
+	// Format is the output format to generate, FormatBind when empty
+	Format string
+	// SkipManaged leaves out the records Netlify manages itself, including
+	// every NETLIFY and NETLIFYv6 record
+	SkipManaged bool
+	// FlattenAliases replaces apex NETLIFY and NETLIFYv6 records with the
+	// A and AAAA records their targets resolve to through Resolver, or the
+	// system resolver when Resolver is nil
+	FlattenAliases bool
+	Resolver       Resolver
+	// FailOnEmpty makes zones without any records an error, after still
+	// exporting them. Such zones are always logged as a warning since they
+	// usually mean a misconfigured zone or a token for the wrong team.
+	FailOnEmpty bool
+	// FailFast stops the export at the first zone that fails instead of
+	// exporting the others
+	FailFast bool
+	// IncludeTypes restricts the export to records of the listed types, and
+	// ExcludeTypes leaves out records of the listed types unless
+	// IncludeTypes is set too, in which case it wins. NETLIFY and NETLIFYv6
+	// records also match CNAME, the type they are written as.
+	IncludeTypes []string
+	ExcludeTypes []string
+	// HostnameMatch, when set, restricts the export to records whose
+	// hostname, without a trailing dot, it matches, and HostnameNotMatch
+	// leaves out the records whose hostname it matches
+	HostnameMatch    *regexp.Regexp
+	HostnameNotMatch *regexp.Regexp
+	// ChangedSince, when set, leaves out the zones Netlify reports as last
+	// updated at or before it. This is best effort, zones without an update
+	// time are always exported.
+	ChangedSince time.Time
+	// OnProgress, when set, is called each time the records of a zone have
+	// been fetched, one call at a time but from the goroutines fetching them
+	OnProgress func(ExportProgress)
+}
+
+// ExportProgress reports that the records of Zone were fetched, the Done-th
+// of Total zones to finish
+type ExportProgress struct {
+	Done, Total int
+	Zone        DnsZone
+	Records     int
+	Err         error
+}
+
+// exportedZone is a generated zone file, in the export's output format, and
+// the zone and records it was generated from
+type exportedZone struct {
+	zone     DnsZone
+	records  []DnsRecord
+	contents string
+}
+
+// ExportZones fetches the zones available from client and generates their zone
+// files, returning them keyed by zone name. Zones that fail are left out and
+// their errors joined into the returned error, unless opts.FailFast is set
+// in which case nothing is returned besides the first error.
+//
+// ExportZones keeps no state between calls and writes nothing but the logs
+// of opts.ZoneOptions.Logger, so it may be called from several goroutines at
+// once as long as each call's client is safe for concurrent use, which
+// NetlifyDnsClient is. The slices and maps of opts are only read.
+func ExportZones(ctx context.Context, client ZoneFetcher, opts ExportOptions) (map[string]string, error) {
+	exported, err := exportZones(ctx, client, opts)
+
+	zoneFiles := make(map[string]string, len(exported))
+	for _, result := range exported {
+		zoneFiles[result.zone.Name] = result.contents
+	}
+	return zoneFiles, err
+}
+
+// exportZones does the work of ExportZones, keeping the zones in the order
+// Netlify returned them
+func exportZones(ctx context.Context, client ZoneFetcher, opts ExportOptions) ([]exportedZone, error) {
+	if opts.Concurrency == 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	format, err := lookupFormat(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := newTypeFilter(opts.IncludeTypes, opts.ExcludeTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	zones, err := client.GetAllDnsZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	zones, err = filterZones(zones, opts.Zones)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.ChangedSince.IsZero() {
+		zones = changedZones(zones, opts.ChangedSince, opts.ZoneOptions.logger())
+	}
+
+	var flattener *aliasFlattener
+	if opts.FlattenAliases {
+		flattener = newAliasFlattener(opts.Resolver, opts.ZoneOptions.logger())
+	}
+
+	var exported []exportedZone
+	var errs []error
+	for _, result := range fetchAllRecords(ctx, client, zones, opts.Concurrency, opts.OnProgress) {
+		if result.err != nil {
+			if opts.FailFast {
+				return nil, result.err
+			}
+			errs = append(errs, result.err)
+			continue
+		}
+
+		var emptyErr error
+		if len(result.records) == 0 {
+			opts.ZoneOptions.logger().Warn("zone has no records", "zone", result.zone.Name)
+			if opts.FailOnEmpty {
+				emptyErr = fmt.Errorf("zone %s has no records", result.zone.Name)
+			}
+		}
+
+		records := result.records
+		if opts.SkipManaged {
+			records = unmanagedRecords(records)
+		}
+		if flattener != nil {
+			records = flattener.flatten(ctx, result.zone, records)
+		}
+		records = filter.apply(records)
+		records = matchingHostnames(records, opts.HostnameMatch, opts.HostnameNotMatch)
+
+		contents, err := format.generate(result.zone, records, opts.Redirects, opts.ZoneOptions)
+		if err != nil {
+			err = fmt.Errorf("error generating zone file for %s: %w", result.zone.Name, err)
+			if opts.FailFast {
+				return nil, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+
+		exported = append(exported, exportedZone{zone: result.zone, records: records, contents: contents})
+		if emptyErr != nil {
+			if opts.FailFast {
+				return nil, emptyErr
+			}
+			errs = append(errs, emptyErr)
+		}
+	}
+
+	return exported, errors.Join(errs...)
+}
+
+// logSummary logs the number of zones and records exported, with a count
+// per record type, as a last check that nothing is missing
+func logSummary(logger *slog.Logger, exported []exportedZone) {
+	total := 0
+	counts := make(map[string]int)
+	for _, result := range exported {
+		total += len(result.records)
+		for _, record := range result.records {
+			counts[record.Type]++
+		}
+	}
+
+	var types []string
+	for recordType := range counts {
+		types = append(types, recordType)
+	}
+	sort.Strings(types)
+	for i, recordType := range types {
+		types[i] = fmt.Sprintf("%s: %d", recordType, counts[recordType])
+	}
+
+	logger.Info("export summary", "zones", len(exported), "records", total, "types", strings.Join(types, ", "))
+}
+
+// zoneRecords is the outcome of fetching the records of one zone
+type zoneRecords struct {
+	zone    DnsZone
+	records []DnsRecord
+	err     error
+}
+
+// fetchAllRecords fetches the records of every zone with up to concurrency
+// requests in flight. Results are returned in the order of zones regardless
+// of completion order, each carrying its own error, while completions are
+// reported to onProgress as they happen when it is set.
+func fetchAllRecords(ctx context.Context, client ZoneFetcher, zones []DnsZone, concurrency int, onProgress func(ExportProgress)) []zoneRecords {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]zoneRecords, len(zones))
+	indexes := make(chan int)
+
+	var progressMu sync.Mutex
+	done := 0
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				records, err := client.GetAllDnsRecords(ctx, zones[i].Id)
+				if err != nil {
+					err = fmt.Errorf("error fetching records for %s: %w", zones[i].Name, err)
+				}
+				results[i] = zoneRecords{zone: zones[i], records: records, err: err}
+
+				if onProgress != nil {
+					progressMu.Lock()
+					done++
+					onProgress(ExportProgress{Done: done, Total: len(zones), Zone: zones[i], Records: len(records), Err: err})
+					progressMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range zones {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// unmanagedRecords returns the records that are neither managed by Netlify
+// nor NETLIFY pseudo-records, which a new provider would not carry over
+func unmanagedRecords(records []DnsRecord) []DnsRecord {
+	var unmanaged []DnsRecord
+	for _, record := range records {
+		if !record.Managed && record.Type != "NETLIFY" && record.Type != "NETLIFYv6" {
+			unmanaged = append(unmanaged, record)
+		}
+	}
+	return unmanaged
+}
+
+// recordTypeNames lists the record types Netlify serves, as it spells them
+var recordTypeNames = []string{"A", "AAAA", "CAA", "CNAME", "DS", "MX", "NETLIFY", "NETLIFYv6", "NS", "PTR", "SPF", "SRV", "TLSA", "TXT"}
+
+// typeFilter keeps the records of the types in include, or when include is
+// empty those of the types not in exclude
+type typeFilter struct {
+	include, exclude map[string]bool
+}
+
+func newTypeFilter(include, exclude []string) (typeFilter, error) {
+	var filter typeFilter
+	var err error
+	filter.include, err = recordTypeSet(include)
+	if err == nil {
+		filter.exclude, err = recordTypeSet(exclude)
+	}
+	return filter, err
+}
+
+// ParseRecordType checks that name is a record type, in any case, and
+// returns it as spelled by Netlify, so "netlifyv6" becomes "NETLIFYv6"
+func ParseRecordType(name string) (string, error) {
+	for _, recordType := range recordTypeNames {
+		if strings.EqualFold(strings.TrimSpace(name), recordType) {
+			return recordType, nil
+		}
+	}
+	return "", fmt.Errorf("unknown record type %q, expected one of %s", name, strings.Join(recordTypeNames, ", "))
+}
+
+// recordTypeSet checks that names are record types, in any case, and
+// returns them as spelled by Netlify
+func recordTypeSet(names []string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	for _, name := range names {
+		recordType, err := ParseRecordType(name)
+		if err != nil {
+			return nil, err
+		}
+		set[recordType] = true
+	}
+	return set, nil
+}
+
+func hasType(set map[string]bool, record DnsRecord) bool {
+	return set[record.Type] || set[typeWithReplacement(record.Type)]
+}
+
+func (f typeFilter) apply(records []DnsRecord) []DnsRecord {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return records
+	}
+
+	var kept []DnsRecord
+	for _, record := range records {
+		if len(f.include) > 0 && hasType(f.include, record) || len(f.include) == 0 && !hasType(f.exclude, record) {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+// matchingHostnames returns the records whose hostname matches match and
+// does not match notMatch, either of which may be nil to not filter
+func matchingHostnames(records []DnsRecord, match, notMatch *regexp.Regexp) []DnsRecord {
+	if match == nil && notMatch == nil {
+		return records
+	}
+
+	var kept []DnsRecord
+	for _, record := range records {
+		hostname := strings.TrimSuffix(record.Hostname, ".")
+		if (match == nil || match.MatchString(hostname)) && (notMatch == nil || !notMatch.MatchString(hostname)) {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+// changedZones returns the zones updated after since, or without an update
+// time
+func changedZones(zones []DnsZone, since time.Time, logger *slog.Logger) []DnsZone {
+	var changed []DnsZone
+	for _, zone := range zones {
+		if !zone.UpdatedAt.IsZero() && !zone.UpdatedAt.After(since) {
+			logger.Info("skipping unchanged zone", "zone", zone.Name, "updated_at", zone.UpdatedAt)
+			continue
+		}
+		changed = append(changed, zone)
+	}
+	return changed
+}
+
+// filterZones returns the zones whose names are listed in names, keeping
+// their original order. Every name must match a zone.
+func filterZones(zones []DnsZone, names []string) ([]DnsZone, error) {
+	if len(names) == 0 {
+		return zones, nil
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[normalizeZoneName(name)] = true
+	}
+
+	var filtered []DnsZone
+	for _, zone := range zones {
+		name := normalizeZoneName(zone.Name)
+		if wanted[name] {
+			filtered = append(filtered, zone)
+			delete(wanted, name)
+		}
+	}
+
+	if len(wanted) > 0 {
+		var missing, available []string
+		for name := range wanted {
+			missing = append(missing, name)
+		}
+		for _, zone := range zones {
+			available = append(available, zone.Name)
+		}
+		sort.Strings(missing)
+
+		return nil, fmt.Errorf("zone(s) %s not found, available zones: %s",
+			strings.Join(missing, ", "), strings.Join(available, ", "))
+	}
+
+	return filtered, nil
+}
+
+func normalizeZoneName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,273 @@
+package zonefile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordTypesOf returns the types of records, sorted
+func recordTypesOf(records []DnsRecord) []string {
+	var types []string
+	for _, record := range records {
+		types = append(types, record.Type)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func TestTypeFilter(t *testing.T) {
+	records := []DnsRecord{
+		{Type: "A"}, {Type: "AAAA"}, {Type: "MX"}, {Type: "NETLIFY"}, {Type: "PTR"}, {Type: "TXT"},
+	}
+
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{"include", []string{"a", "PTR"}, nil, []string{"A", "PTR"}},
+		{"include CNAME matches NETLIFY", []string{"CNAME"}, nil, []string{"NETLIFY"}},
+		{"exclude", nil, []string{"TXT", "mx"}, []string{"A", "AAAA", "NETLIFY", "PTR"}},
+		{"include wins over exclude", []string{"A", "AAAA"}, []string{"A"}, []string{"A", "AAAA"}},
+		{"none", nil, nil, []string{"A", "AAAA", "MX", "NETLIFY", "PTR", "TXT"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := newTypeFilter(test.include, test.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := recordTypesOf(filter.apply(records)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTypeFilterRejectsUnknownTypes(t *testing.T) {
+	_, err := newTypeFilter([]string{"BOGUS"}, nil)
+	if err == nil {
+		t.Error("got no error for an unknown record type")
+	}
+}
+
+func TestExportZonesFiltersTypes(t *testing.T) {
+	fetcher := &MemoryZoneFetcher{
+		Zones: []DnsZone{{Id: "z1", Name: "2.0.192.in-addr.arpa"}},
+		Records: map[string][]DnsRecord{"z1": {
+			{Hostname: "1.2.0.192.in-addr.arpa", Type: "PTR", Value: "host.example.com", Ttl: 300},
+			{Hostname: "2.0.192.in-addr.arpa", Type: "TXT", Value: "reverse zone", Ttl: 300},
+		}},
+	}
+
+	exported, err := exportZones(context.Background(), fetcher, ExportOptions{IncludeTypes: []string{"PTR"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 1 || !reflect.DeepEqual(recordTypesOf(exported[0].records), []string{"PTR"}) {
+		t.Errorf("got %+v, want the zone with its PTR record only", exported)
+	}
+}
+
+// zoneServer serves a single zone named name with one A record
+func zoneServer(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "100")
+		switch r.URL.Path {
+		case "/dns_zones":
+			fmt.Fprintf(w, `[{"id": "z1", "name": %q}]`, name)
+		case "/dns_zones/z1/dns_records":
+			fmt.Fprintf(w, `[{"id": "r1", "hostname": "www.%s", "type": "A", "value": "192.0.2.1", "ttl": 300}]`, name)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExportZonesConcurrently(t *testing.T) {
+	opts := ExportOptions{
+		Redirects:   []Redirect{{From: "https://old.example.com/*", To: "https://new.example.com/:splat"}},
+		ZoneOptions: ZoneOptions{GeneratedAt: time.Date(2026, time.October, 14, 0, 0, 0, 0, time.UTC)},
+		Concurrency: 2,
+	}
+
+	names := []string{"example.com", "example.net", "example.org", "example.dev"}
+	zoneFiles := make([]map[string]string, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		client := NewNetlifyDnsClient("token", WithBaseURL(zoneServer(t, name).URL))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			zoneFiles[i], errs[i] = ExportZones(context.Background(), &client, opts)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		if errs[i] != nil {
+			t.Errorf("%s: %v", name, errs[i])
+			continue
+		}
+		if len(zoneFiles[i]) != 1 || !strings.Contains(zoneFiles[i][name], "www\tIN\tA\t192.0.2.1") {
+			t.Errorf("%s: got zone files %q", name, zoneFiles[i])
+		}
+	}
+}
+
+// slowFetcher answers for the records of earlier zones last, so a worker
+// pool gets them out of order
+type slowFetcher struct {
+	MemoryZoneFetcher
+}
+
+func (f *slowFetcher) GetAllDnsRecords(ctx context.Context, zoneId string) ([]DnsRecord, error) {
+	for i, zone := range f.Zones {
+		if zone.Id == zoneId {
+			time.Sleep(time.Duration(len(f.Zones)-i) * 5 * time.Millisecond)
+		}
+	}
+	return f.MemoryZoneFetcher.GetAllDnsRecords(ctx, zoneId)
+}
+
+func TestExportZonesKeepsZoneOrderAndIsolatesErrors(t *testing.T) {
+	fetcher := &slowFetcher{MemoryZoneFetcher{
+		Records: make(map[string][]DnsRecord),
+		Errors:  map[string]error{"z3": errors.New("boom")},
+	}}
+	var want []string
+	for i := 1; i <= 6; i++ {
+		id, name := fmt.Sprintf("z%d", i), fmt.Sprintf("zone%d.example", i)
+		fetcher.Zones = append(fetcher.Zones, DnsZone{Id: id, Name: name})
+		fetcher.Records[id] = []DnsRecord{{Hostname: name, Type: "A", Value: "192.0.2.1", Ttl: 300}}
+		if id != "z3" {
+			want = append(want, name)
+		}
+	}
+
+	exported, err := exportZones(context.Background(), fetcher, ExportOptions{Concurrency: 3})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("got error %v, want the error of z3", err)
+	}
+
+	var got []string
+	for _, result := range exported {
+		got = append(got, result.zone.Name)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got zones %q, want %q", got, want)
+	}
+}
+
+func TestExportZonesFromMemoryFetcher(t *testing.T) {
+	fetcher := &MemoryZoneFetcher{
+		Zones: []DnsZone{{Id: "z1", Name: "example.com"}, {Id: "z2", Name: "example.org"}},
+		Records: map[string][]DnsRecord{
+			"z1": {{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1", Ttl: 300}},
+			"z2": {{Hostname: "example.org", Type: "MX", Value: "mail.example.org", Priority: 10, Ttl: 300}},
+		},
+	}
+
+	zoneFiles, err := ExportZones(context.Background(), fetcher, ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"example.com": "www\tIN\tA\t192.0.2.1",
+		"example.org": "@\tIN\tMX\t10\tmail.example.org.",
+	}
+	if len(zoneFiles) != len(want) {
+		t.Fatalf("got zone files for %d zones, want %d", len(zoneFiles), len(want))
+	}
+	for name, line := range want {
+		if got := recordLines(t, zoneFiles[name]); !reflect.DeepEqual(got, []string{line}) {
+			t.Errorf("%s: got record lines %q, want %q", name, got, line)
+		}
+	}
+}
+
+func TestExportZonesSkipsManagedRecords(t *testing.T) {
+	fetcher := &MemoryZoneFetcher{
+		Zones: []DnsZone{{Id: "z1", Name: "example.com"}},
+		Records: map[string][]DnsRecord{"z1": {
+			{Hostname: "example.com", Type: "NETLIFY", Value: "example.netlify.app"},
+			{Hostname: "example.com", Type: "NS", Value: "dns1.p01.nsone.net", Managed: true},
+			{Hostname: "example.com", Type: "TXT", Value: "v=spf1 -all"},
+		}},
+	}
+
+	tests := []struct {
+		skipManaged bool
+		want        []string
+	}{
+		{false, []string{"NETLIFY", "NS", "TXT"}},
+		{true, []string{"TXT"}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint("SkipManaged=", test.skipManaged), func(t *testing.T) {
+			exported, err := exportZones(context.Background(), fetcher, ExportOptions{SkipManaged: test.skipManaged})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(exported) != 1 {
+				t.Fatalf("got %d zones, want 1", len(exported))
+			}
+			if got := recordTypesOf(exported[0].records); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchingHostnames(t *testing.T) {
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "A"},
+		{Hostname: "www.example.com.", Type: "CNAME"},
+		{Hostname: "staging.example.com", Type: "A"},
+		{Hostname: "api.staging.example.com", Type: "A"},
+	}
+
+	tests := []struct {
+		name            string
+		match, notMatch string
+		want            []string
+	}{
+		{"match", `^www\.`, "", []string{"www.example.com."}},
+		{"match without trailing dot", `example\.com$`, "", []string{"example.com", "www.example.com.", "staging.example.com", "api.staging.example.com"}},
+		{"not match", "", `staging`, []string{"example.com", "www.example.com."}},
+		{"both", `staging`, `^api\.`, []string{"staging.example.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var match, notMatch *regexp.Regexp
+			if test.match != "" {
+				match = regexp.MustCompile(test.match)
+			}
+			if test.notMatch != "" {
+				notMatch = regexp.MustCompile(test.notMatch)
+			}
+
+			var got []string
+			for _, record := range matchingHostnames(records, match, notMatch) {
+				got = append(got, record.Hostname)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
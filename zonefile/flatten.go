@@ -0,0 +1,97 @@
+package zonefile
+
+import (
+	"context"
+	"log/slog"
+	"net"
+)
+
+// Resolver looks up the addresses of a hostname. *net.Resolver implements
+// it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+var _ Resolver = (*net.Resolver)(nil)
+
+// aliasFlattener replaces apex NETLIFY and NETLIFYv6 records, which Netlify
+// serves like ALIAS records, with the A and AAAA records their targets
+// resolve to, for providers that support neither ALIAS records nor a CNAME
+// at the apex. Lookups are cached across zones.
+type aliasFlattener struct {
+	resolver Resolver
+	logger   *slog.Logger
+	cache    map[string][]net.IPAddr
+}
+
+func newAliasFlattener(resolver Resolver, logger *slog.Logger) *aliasFlattener {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &aliasFlattener{resolver: resolver, logger: logger, cache: make(map[string][]net.IPAddr)}
+}
+
+// flatten returns the records of zone with its apex NETLIFY records
+// flattened. Records whose target cannot be resolved are kept with a
+// warning, to be left out of zone files where they would be apex CNAMEs.
+func (f *aliasFlattener) flatten(ctx context.Context, zone DnsZone, records []DnsRecord) []DnsRecord {
+	var flattened []DnsRecord
+	for _, record := range records {
+		addressType := flattenedType(record.Type)
+		if addressType == "" || normalizeZoneName(record.Hostname) != normalizeZoneName(zone.Name) {
+			flattened = append(flattened, record)
+			continue
+		}
+
+		addresses, err := f.lookup(ctx, record.Value)
+		if err != nil {
+			f.logger.Warn("cannot flatten record", "zone", zone.Name, "type", record.Type, "target", record.Value, "error", err)
+			flattened = append(flattened, record)
+			continue
+		}
+
+		found := false
+		for _, address := range addresses {
+			if (address.IP.To4() != nil) != (addressType == "A") {
+				continue
+			}
+			found = true
+
+			flat := record
+			flat.Type = addressType
+			flat.Value = address.IP.String()
+			flattened = append(flattened, flat)
+		}
+		if !found {
+			f.logger.Warn("cannot flatten record, its target has no addresses of that family", "zone", zone.Name, "type", record.Type, "target", record.Value, "want", addressType)
+			flattened = append(flattened, record)
+		}
+	}
+	return flattened
+}
+
+func (f *aliasFlattener) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	host = normalizeZoneName(host)
+	if addresses, ok := f.cache[host]; ok {
+		return addresses, nil
+	}
+
+	addresses, err := f.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	f.cache[host] = addresses
+	return addresses, nil
+}
+
+// flattenedType returns the address record type replacing a NETLIFY
+// pseudo-record, or "" for other types
+func flattenedType(recordType string) string {
+	switch recordType {
+	case "NETLIFY":
+		return "A"
+	case "NETLIFYv6":
+		return "AAAA"
+	}
+	return ""
+}
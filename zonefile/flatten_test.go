@@ -0,0 +1,73 @@
+package zonefile
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// stubResolver answers lookups from a map, counting them
+type stubResolver struct {
+	addresses map[string][]string
+	lookups   int
+}
+
+func (r *stubResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups++
+	var addresses []net.IPAddr
+	for _, address := range r.addresses[host] {
+		addresses = append(addresses, net.IPAddr{IP: net.ParseIP(address)})
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	return addresses, nil
+}
+
+func TestExportZonesFlattensApexAliases(t *testing.T) {
+	resolver := &stubResolver{addresses: map[string][]string{
+		"example.netlify.app": {"192.0.2.10", "192.0.2.11", "2001:db8::10"},
+	}}
+	fetcher := &MemoryZoneFetcher{
+		Zones: []DnsZone{{Id: "z1", Name: "example.com"}, {Id: "z2", Name: "example.org"}},
+		Records: map[string][]DnsRecord{
+			"z1": {
+				{Hostname: "example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+				{Hostname: "example.com", Type: "NETLIFYv6", Value: "example.netlify.app", Ttl: 3600},
+				{Hostname: "www.example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+			},
+			"z2": {
+				{Hostname: "example.org", Type: "NETLIFY", Value: "gone.netlify.app", Ttl: 3600},
+				{Hostname: "example.org", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+			},
+		},
+	}
+
+	zoneFiles, err := ExportZones(context.Background(), fetcher, ExportOptions{FlattenAliases: true, Resolver: resolver, Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"example.com": {
+			"@\tIN\tA\t192.0.2.10",
+			"@\tIN\tA\t192.0.2.11",
+			"@\tIN\tAAAA\t2001:db8::10",
+			"www\tIN\tCNAME\texample.netlify.app.",
+		},
+		"example.org": {
+			"@\tIN\tA\t192.0.2.10",
+			"@\tIN\tA\t192.0.2.11",
+		},
+	}
+	for name, lines := range want {
+		if got := recordLines(t, zoneFiles[name]); !reflect.DeepEqual(got, lines) {
+			t.Errorf("%s: got record lines %q, want %q", name, got, lines)
+		}
+	}
+	if resolver.lookups != 2 {
+		t.Errorf("got %d lookups, want 2 as results are cached", resolver.lookups)
+	}
+}
@@ -0,0 +1,308 @@
+package zonefile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by ExportOptions.Format and the -format flag
+const (
+	FormatBind       = "bind"
+	FormatCloudflare = "cloudflare"
+	FormatJSON       = "json"
+	FormatYAML       = "yaml"
+	FormatRoute53    = "route53"
+	FormatCSV        = "csv"
+	// FormatManagedReport lists the records Netlify manages apart from the
+	// ones created by hand
+	FormatManagedReport = "managed-report"
+)
+
+// outputFormat describes how zones are rendered in one output format
+type outputFormat struct {
+	extension string
+	// zoneFile is set for formats producing BIND zone files, and omitsSOA
+	// for those of them leaving out the SOA record
+	zoneFile bool
+	omitsSOA bool
+	// commentPrefix starts a comment line in the format, empty when the
+	// format has no comments
+	commentPrefix string
+	generate      func(zone DnsZone, records []DnsRecord, redirects []Redirect, opts ZoneOptions) (string, error)
+}
+
+var outputFormats = map[string]outputFormat{
+	FormatBind:       {extension: ".zone", zoneFile: true, commentPrefix: ";", generate: GenerateZoneFile},
+	FormatCloudflare: {extension: ".zone", zoneFile: true, omitsSOA: true, commentPrefix: ";", generate: generateCloudflareZoneFile},
+	FormatJSON:       {extension: ".json", generate: generateZoneJSON},
+	FormatYAML:       {extension: ".yaml", commentPrefix: "#", generate: generateZoneYAML},
+	FormatRoute53:    {extension: ".route53.json", generate: generateRoute53ChangeBatch},
+	FormatCSV:        {extension: ".csv", generate: generateZoneCSV},
+
+	FormatManagedReport: {extension: ".report.txt", commentPrefix: "#", generate: generateManagedReport},
+}
+
+// lookupFormat returns the named output format, bind when name is empty
+func lookupFormat(name string) (outputFormat, error) {
+	if name == "" {
+		name = FormatBind
+	}
+
+	format, ok := outputFormats[name]
+	if !ok {
+		var names []string
+		for known := range outputFormats {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return outputFormat{}, fmt.Errorf("unknown format %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return format, nil
+}
+
+// generateCloudflareZoneFile writes a zone file for Cloudflare's importer.
+// NETLIFY and NETLIFYv6 records become CNAMEs to their target, as in the
+// bind format but also at the apex, where Cloudflare flattens CNAMEs, and
+// the SOA and apex NS records are left out because Cloudflare manages them
+// itself.
+func generateCloudflareZoneFile(zone DnsZone, records []DnsRecord, redirects []Redirect, opts ZoneOptions) (string, error) {
+	opts.ApexCNAME = true
+	opts.OmitSOA = true
+	opts.OmitApexNS = true
+	return GenerateZoneFile(zone, records, redirects, opts)
+}
+
+// ZoneDocument is the JSON representation of a zone and its records
+type ZoneDocument struct {
+	Zone    DnsZone     `json:"zone"`
+	Records []DnsRecord `json:"records"`
+}
+
+// generateZoneJSON renders the zone and its records, as returned by
+// Netlify, as an indented JSON document
+func generateZoneJSON(zone DnsZone, records []DnsRecord, redirects []Redirect, opts ZoneOptions) (string, error) {
+	document := ZoneDocument{Zone: zone, Records: sortRecords(records, zone.Name)}
+	if document.Records == nil {
+		document.Records = []DnsRecord{}
+	}
+
+	content, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshalling zone document: %w", err)
+	}
+	return string(content) + "\n", nil
+}
+
+// yamlZone and yamlRecord declare their fields in alphabetical order so the
+// generated keys are sorted and stable
+type yamlZone struct {
+	Name    string       `yaml:"name"`
+	Records []yamlRecord `yaml:"records"`
+}
+
+type yamlRecord struct {
+	Name  string `yaml:"name"`
+	Ttl   int    `yaml:"ttl"`
+	Type  string `yaml:"type"`
+	Value string `yaml:"value"`
+}
+
+// generateZoneYAML renders the records of a zone as a flat YAML list, in
+// the shape external-dns style tooling expects. Values hold the record data
+// as it appears in a zone file, with NETLIFY records converted to CNAME and
+// left out at the apex.
+func generateZoneYAML(zone DnsZone, records []DnsRecord, redirects []Redirect, opts ZoneOptions) (string, error) {
+	document := yamlZone{Name: normalizeZoneName(zone.Name), Records: []yamlRecord{}}
+	for _, record := range sortRecords(opts.overrideTtls(records), zone.Name) {
+		if opts.skipApexAlias(zone.Name, record) {
+			continue
+		}
+		document.Records = append(document.Records, yamlRecord{
+			Name:  normalizeZoneName(record.Hostname),
+			Ttl:   record.Ttl,
+			Type:  typeWithReplacement(record.Type),
+			Value: strings.ReplaceAll(recordData(record, redirectedValue(record, redirects, opts)), "\t", " "),
+		})
+	}
+
+	var content strings.Builder
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(2)
+	err := encoder.Encode(document)
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("error marshalling zone document: %w", err)
+	}
+	return content.String(), nil
+}
+
+// The route53* types mirror the ChangeBatch accepted by
+// aws route53 change-resource-record-sets --change-batch
+type route53ChangeBatch struct {
+	Comment string          `json:"Comment,omitempty"`
+	Changes []route53Change `json:"Changes"`
+}
+
+type route53Change struct {
+	Action            string           `json:"Action"`
+	ResourceRecordSet route53RecordSet `json:"ResourceRecordSet"`
+}
+
+type route53RecordSet struct {
+	Name            string                  `json:"Name"`
+	Type            string                  `json:"Type"`
+	TTL             int                     `json:"TTL"`
+	ResourceRecords []route53ResourceRecord `json:"ResourceRecords"`
+}
+
+type route53ResourceRecord struct {
+	Value string `json:"Value"`
+}
+
+// generateRoute53ChangeBatch groups the records of a zone by name and type
+// into UPSERT changes. NETLIFY records become CNAMEs, except at the apex
+// where they are skipped like the apex NS records Route53 creates itself,
+// and a set whose records disagree on TTL uses the lowest one since Route53
+// allows a single TTL per set. Records without a TTL get the zone's default,
+// the $TTL of the bind format.
+func generateRoute53ChangeBatch(zone DnsZone, records []DnsRecord, redirects []Redirect, opts ZoneOptions) (string, error) {
+	opts = opts.withDefaults()
+	records = opts.overrideTtls(records)
+	defaultTtl := opts.DefaultTtl
+	if defaultTtl == 0 {
+		defaultTtl = mostCommonTtl(records, opts.Minimum)
+	}
+
+	batch := route53ChangeBatch{
+		Comment: fmt.Sprintf("Import of %s from Netlify", normalizeZoneName(zone.Name)),
+		Changes: []route53Change{},
+	}
+
+	sets := make(map[[2]string]int)
+	for _, record := range sortRecords(records, zone.Name) {
+		if record.Ttl == 0 {
+			record.Ttl = defaultTtl
+		}
+		name := normalizeZoneName(record.Hostname) + "."
+		recordType := typeWithReplacement(record.Type)
+		if recordType == "NS" && normalizeZoneName(record.Hostname) == normalizeZoneName(zone.Name) || opts.skipApexAlias(zone.Name, record) {
+			continue
+		}
+
+		key := [2]string{name, recordType}
+		i, ok := sets[key]
+		if !ok {
+			i = len(batch.Changes)
+			sets[key] = i
+			batch.Changes = append(batch.Changes, route53Change{
+				Action:            "UPSERT",
+				ResourceRecordSet: route53RecordSet{Name: name, Type: recordType, TTL: record.Ttl},
+			})
+		}
+
+		set := &batch.Changes[i].ResourceRecordSet
+		if record.Ttl < set.TTL {
+			set.TTL = record.Ttl
+		}
+
+		value := strings.ReplaceAll(recordData(record, redirectedValue(record, redirects, opts)), "\t", " ")
+		duplicate := false
+		for _, existing := range set.ResourceRecords {
+			duplicate = duplicate || existing.Value == value
+		}
+		if !duplicate {
+			set.ResourceRecords = append(set.ResourceRecords, route53ResourceRecord{Value: value})
+		}
+	}
+
+	content, err := json.MarshalIndent(batch, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshalling change batch: %w", err)
+	}
+	return string(content) + "\n", nil
+}
+
+// csvHeader names the columns written by generateZoneCSV
+var csvHeader = []string{"hostname", "type", "ttl", "priority", "value", "weight", "port", "flag", "tag"}
+
+// generateZoneCSV lists the records of a zone as CSV, one per row after a
+// header row, for audits. Types are kept as Netlify returns them, and the
+// weight, port, flag and tag columns are empty for records without them.
+func generateZoneCSV(zone DnsZone, records []DnsRecord, redirects []Redirect, opts ZoneOptions) (string, error) {
+	var content strings.Builder
+	writer := csv.NewWriter(&content)
+	err := writer.Write(csvHeader)
+	for _, record := range sortRecords(opts.overrideTtls(records), zone.Name) {
+		if err != nil {
+			break
+		}
+		err = writer.Write([]string{
+			normalizeZoneName(record.Hostname),
+			record.Type,
+			fmt.Sprint(record.Ttl),
+			fmt.Sprint(record.Priority),
+			redirectedValue(record, redirects, opts),
+			optionalInt(record.Weight),
+			optionalInt(record.Port),
+			stringOrEmpty(record.Flag),
+			stringOrEmpty(record.Tag),
+		})
+	}
+	if err == nil {
+		writer.Flush()
+		err = writer.Error()
+	}
+	if err != nil {
+		return "", fmt.Errorf("error writing zone CSV: %w", err)
+	}
+	return content.String(), nil
+}
+
+func optionalInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return fmt.Sprint(*i)
+}
+
+// generateManagedReport lists the records of a zone in two sections, the
+// records Netlify manages and the unmanaged ones, each headed by its count,
+// so manual changes can be audited. Types are kept as Netlify returns them.
+func generateManagedReport(zone DnsZone, records []DnsRecord, redirects []Redirect, opts ZoneOptions) (string, error) {
+	var managed, unmanaged []DnsRecord
+	for _, record := range sortRecords(opts.overrideTtls(records), zone.Name) {
+		if record.Managed {
+			managed = append(managed, record)
+		} else {
+			unmanaged = append(unmanaged, record)
+		}
+	}
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "# %s: %d managed, %d unmanaged records\n", normalizeZoneName(zone.Name), len(managed), len(unmanaged))
+	for _, section := range []struct {
+		name    string
+		records []DnsRecord
+	}{{"managed", managed}, {"unmanaged", unmanaged}} {
+		fmt.Fprintf(&content, "\n# %s (%d)\n", section.name, len(section.records))
+
+		table := tabwriter.NewWriter(&content, 0, 8, 1, ' ', 0)
+		for _, record := range section.records {
+			value := strings.ReplaceAll(recordData(record, redirectedValue(record, redirects, opts)), "\t", " ")
+			fmt.Fprintf(table, "%s\t%d\t%s\t%s\n", normalizeZoneName(record.Hostname), record.Ttl, record.Type, value)
+		}
+		err := table.Flush()
+		if err != nil {
+			return "", fmt.Errorf("error writing managed report: %w", err)
+		}
+	}
+	return content.String(), nil
+}
@@ -0,0 +1,202 @@
+package zonefile
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApexNetlifyRecordsAreOnlyKeptForCloudflare(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+		{Hostname: "www.example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+	}
+
+	var logs bytes.Buffer
+	opts := ZoneOptions{Strict: true, Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+
+	bind, err := GenerateZoneFile(zone, records, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(bind, "@\tIN\tCNAME") {
+		t.Errorf("bind zone file has an apex CNAME:\n%s", bind)
+	}
+	if !strings.Contains(bind, "www\tIN\tCNAME\texample.netlify.app.\n") {
+		t.Errorf("bind zone file is missing the www CNAME:\n%s", bind)
+	}
+	if !strings.Contains(logs.String(), "skipping apex record") {
+		t.Errorf("no warning about the skipped apex record in %q", logs.String())
+	}
+
+	cloudflare, err := generateCloudflareZoneFile(zone, records, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cloudflare, "@\tIN\tCNAME\texample.netlify.app.\n") {
+		t.Errorf("cloudflare zone file is missing the apex CNAME:\n%s", cloudflare)
+	}
+}
+
+func TestGenerateRoute53ChangeBatch(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "NS", Value: "dns1.p01.nsone.net", Ttl: 3600},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1", Ttl: 300},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.2", Ttl: 60},
+		{Hostname: "api.example.com", Type: "A", Value: "192.0.2.3"},
+		{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 300},
+		{Hostname: "blog.example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 300},
+	}
+
+	content, err := generateRoute53ChangeBatch(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batch route53ChangeBatch
+	if err := json.Unmarshal([]byte(content), &batch); err != nil {
+		t.Fatalf("change batch is not valid JSON: %v\n%s", err, content)
+	}
+
+	set := func(name, recordType string, ttl int, values ...string) route53Change {
+		change := route53Change{Action: "UPSERT", ResourceRecordSet: route53RecordSet{Name: name, Type: recordType, TTL: ttl}}
+		for _, value := range values {
+			change.ResourceRecordSet.ResourceRecords = append(change.ResourceRecordSet.ResourceRecords, route53ResourceRecord{Value: value})
+		}
+		return change
+	}
+	want := route53ChangeBatch{
+		Comment: "Import of example.com from Netlify",
+		Changes: []route53Change{
+			set("example.com.", "MX", 300, "10 mail.example.com."),
+			set("api.example.com.", "A", 300, "192.0.2.3"),
+			set("blog.example.com.", "CNAME", 300, "example.netlify.app."),
+			set("www.example.com.", "A", 60, "192.0.2.1", "192.0.2.2"),
+		},
+	}
+	if !reflect.DeepEqual(batch, want) {
+		t.Errorf("got change batch\n%s\nwant %+v", content, want)
+	}
+}
+
+func TestGenerateZoneJSONRoundTrips(t *testing.T) {
+	zone := DnsZone{Id: "z1", Name: "example.com"}
+	records := []DnsRecord{
+		{Id: "r1", Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 3600, DnsZoneId: "z1"},
+		{Id: "r2", Hostname: "_sip._tcp.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(5), Port: intPtr(5060), Ttl: 300, DnsZoneId: "z1"},
+		{Id: "r3", Hostname: "example.com", Type: "CAA", Value: "letsencrypt.org", Flag: stringPtr("0"), Tag: stringPtr("issue"), Ttl: 3600, DnsZoneId: "z1"},
+		{Id: "r4", Hostname: "www.example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600, Managed: true, DnsZoneId: "z1"},
+	}
+
+	content, err := generateZoneJSON(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document ZoneDocument
+	if err := json.Unmarshal([]byte(content), &document); err != nil {
+		t.Fatalf("document is not valid JSON: %v\n%s", err, content)
+	}
+
+	if !reflect.DeepEqual(document.Zone, zone) {
+		t.Errorf("got zone %+v, want %+v", document.Zone, zone)
+	}
+	if want := sortRecords(records, zone.Name); !reflect.DeepEqual(document.Records, want) {
+		t.Errorf("got records %+v, want %+v", document.Records, want)
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden compares got with the golden file testdata/name, rewriting it
+// instead with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s, rerun with -update if intended:\n%s", path, got)
+	}
+}
+
+// goldenRecords is the zone the golden files in testdata are generated from
+var goldenRecords = []DnsRecord{
+	{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+	{Hostname: "example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+	{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 3600},
+	{Hostname: "example.com", Type: "TXT", Value: "v=spf1 include:_spf.example.net -all", Ttl: 3600},
+	{Hostname: "example.com", Type: "CAA", Value: "letsencrypt.org", Flag: stringPtr("0"), Tag: stringPtr("issue"), Ttl: 3600},
+	{Hostname: "www.example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 300},
+	{Hostname: "_sip._tcp.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(5), Port: intPtr(5060), Ttl: 3600},
+}
+
+func TestGenerateZoneYAMLGolden(t *testing.T) {
+	content, err := generateZoneYAML(DnsZone{Name: "example.com"}, goldenRecords, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "example.com.yaml", content)
+}
+
+func TestGenerateZoneCSVGolden(t *testing.T) {
+	content, err := generateZoneCSV(DnsZone{Name: "example.com"}, goldenRecords, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "example.com.csv", content)
+}
+
+func TestGenerateManagedReportGolden(t *testing.T) {
+	records := append([]DnsRecord{
+		{Hostname: "example.com", Type: "NS", Value: "dns1.p01.nsone.net", Ttl: 3600, Managed: true},
+		{Hostname: "example.com", Type: "NS", Value: "dns2.p01.nsone.net", Ttl: 3600, Managed: true},
+	}, goldenRecords...)
+	content, err := generateManagedReport(DnsZone{Name: "example.com"}, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "example.com.report.txt", content)
+}
+
+func TestGenerateCloudflareZoneFile(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "NS", Value: "dns1.p01.nsone.net", Ttl: 3600},
+		{Hostname: "example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+		{Hostname: "www.example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+		{Hostname: "v6.example.com", Type: "NETLIFYv6", Value: "example.netlify.app", Ttl: 3600},
+		{Hostname: "sub.example.com", Type: "NS", Value: "ns1.other.net", Ttl: 3600},
+	}
+
+	zoneFile, err := generateCloudflareZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(zoneFile, "\tSOA\t") {
+		t.Errorf("cloudflare zone file has an SOA record:\n%s", zoneFile)
+	}
+	want := []string{
+		"@\tIN\tCNAME\texample.netlify.app.",
+		"sub\tIN\tNS\tns1.other.net.",
+		"v6\tIN\tCNAME\texample.netlify.app.",
+		"www\tIN\tCNAME\texample.netlify.app.",
+	}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,33 @@
+package zonefile
+
+import (
+	"io"
+	"log/slog"
+)
+
+// discardLogger is used where no logger was configured
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// NewLogger returns the logger the command writes its diagnostics to: info
+// and above by default, debug and above when verbose and only errors when
+// quiet. Zone contents are written to standard output or files, never here.
+func NewLogger(w io.Writer, verbose, quiet bool) *slog.Logger {
+	level := slog.LevelInfo
+	switch {
+	case verbose:
+		level = slog.LevelDebug
+	case quiet:
+		level = slog.LevelError
+	}
+
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		// Timestamps only add noise to the output of a short-lived command
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+}
@@ -0,0 +1,42 @@
+package zonefile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerLevels(t *testing.T) {
+	tests := []struct {
+		name           string
+		verbose, quiet bool
+		want           []string
+	}{
+		{"default", false, false, []string{"INFO", "WARN", "ERROR"}},
+		{"verbose", true, false, []string{"DEBUG", "INFO", "WARN", "ERROR"}},
+		{"quiet", false, true, []string{"ERROR"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			logger := NewLogger(&stderr, test.verbose, test.quiet)
+			logger.Debug("debug message")
+			logger.Info("info message")
+			logger.Warn("warn message")
+			logger.Error("error message")
+
+			var levels []string
+			for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+				if strings.HasPrefix(line, "time=") {
+					t.Errorf("got a timestamp in %q", line)
+				}
+				level, _, _ := strings.Cut(strings.TrimPrefix(line, "level="), " ")
+				levels = append(levels, level)
+			}
+			if !reflect.DeepEqual(levels, test.want) {
+				t.Errorf("got levels %q, want %q:\n%s", levels, test.want, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package zonefile
+
+import (
+	"context"
+	"fmt"
+)
+
+// MemoryZoneFetcher is a ZoneFetcher serving zones and records held in
+// memory, for tests and for generating zone files from data fetched
+// elsewhere. It is also a ZoneApplier changing those records in place.
+type MemoryZoneFetcher struct {
+	Zones []DnsZone
+	// Records holds the records of each zone, keyed by zone ID
+	Records map[string][]DnsRecord
+	// Errors makes GetAllDnsRecords fail for the zone IDs it contains
+	Errors map[string]error
+
+	nextId int
+}
+
+func (m *MemoryZoneFetcher) GetAllDnsZones(ctx context.Context) ([]DnsZone, error) {
+	return append([]DnsZone(nil), m.Zones...), nil
+}
+
+func (m *MemoryZoneFetcher) GetDnsZone(ctx context.Context, zoneId string) (DnsZone, error) {
+	for _, zone := range m.Zones {
+		if zone.Id == zoneId {
+			return zone, nil
+		}
+	}
+	return DnsZone{}, &APIError{StatusCode: 404, Endpoint: "dns_zones/" + zoneId}
+}
+
+func (m *MemoryZoneFetcher) GetAllDnsRecords(ctx context.Context, zoneId string) ([]DnsRecord, error) {
+	if err, ok := m.Errors[zoneId]; ok {
+		return nil, err
+	}
+
+	for _, zone := range m.Zones {
+		if zone.Id == zoneId {
+			return append([]DnsRecord(nil), m.Records[zoneId]...), nil
+		}
+	}
+	return nil, fmt.Errorf("zone %s not found", zoneId)
+}
+
+func (m *MemoryZoneFetcher) GetDnsRecord(ctx context.Context, zoneId, recordId string) (DnsRecord, error) {
+	for _, record := range m.Records[zoneId] {
+		if record.Id == recordId {
+			return record, nil
+		}
+	}
+	return DnsRecord{}, &APIError{StatusCode: 404, Endpoint: "dns_zones/" + zoneId + "/dns_records/" + recordId}
+}
+
+// CreateDnsRecord adds record to the zone, giving it an ID of its own
+func (m *MemoryZoneFetcher) CreateDnsRecord(ctx context.Context, zoneId string, record DnsRecord) (DnsRecord, error) {
+	if m.Records == nil {
+		m.Records = make(map[string][]DnsRecord)
+	}
+
+	m.nextId++
+	record.Id = fmt.Sprintf("memory-%d", m.nextId)
+	record.DnsZoneId = zoneId
+	m.Records[zoneId] = append(m.Records[zoneId], record)
+	return record, nil
+}
+
+func (m *MemoryZoneFetcher) DeleteDnsRecord(ctx context.Context, zoneId, recordId string) error {
+	records := m.Records[zoneId]
+	for i, record := range records {
+		if record.Id == recordId {
+			m.Records[zoneId] = append(records[:i:i], records[i+1:]...)
+			return nil
+		}
+	}
+	return &APIError{StatusCode: 404, Endpoint: "dns_zones/" + zoneId + "/dns_records/" + recordId}
+}
@@ -0,0 +1,70 @@
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsPrefix namespaces the metrics written for -metrics-file
+const metricsPrefix = "netlify_dns_zone_file_"
+
+// exportMetrics describes one export run, written for the textfile
+// collector of the Prometheus node exporter
+type exportMetrics struct {
+	Zones, Records int
+	Duration       time.Duration
+	// LastSuccess is when an export last succeeded, zero when none has
+	LastSuccess time.Time
+}
+
+// writeMetrics writes metrics to path in the Prometheus text format. The
+// file is replaced atomically so the collector never reads half of it.
+func writeMetrics(path string, metrics exportMetrics) error {
+	var content strings.Builder
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(&content, "# HELP %s%s %s\n# TYPE %s%s gauge\n%s%s %s\n",
+			metricsPrefix, name, help, metricsPrefix, name, metricsPrefix, name, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+
+	gauge("zones_total", "Zones exported by the last run.", float64(metrics.Zones))
+	gauge("records_total", "Records exported by the last run.", float64(metrics.Records))
+	gauge("export_duration_seconds", "Duration of the last run in seconds.", metrics.Duration.Seconds())
+	if !metrics.LastSuccess.IsZero() {
+		gauge("last_success_timestamp_seconds", "Unix time of the last successful run.", float64(metrics.LastSuccess.Unix()))
+	}
+
+	err := writeFileAtomic(path, []byte(content.String()))
+	if err != nil {
+		return fmt.Errorf("error writing metrics: %w", err)
+	}
+	return nil
+}
+
+// lastSuccess returns the time of the last successful run recorded in the
+// metrics file at path, so a failed run keeps it, or the zero time when
+// there is none
+func lastSuccess(path string) time.Time {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), metricsPrefix+"last_success_timestamp_seconds ")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		return time.Unix(int64(seconds), 0)
+	}
+	return time.Time{}
+}
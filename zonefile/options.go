@@ -0,0 +1,134 @@
+package zonefile
+
+import (
+	"regexp"
+	"time"
+)
+
+// Options is everything the command line tool can be told to do, set from
+// its flags by the netlify-dns-zone-file command. The zero value exports
+// every zone to bind .zone files in the current directory, reading
+// redirects from netlify.toml and _redirects when they exist, like running
+// the tool without flags.
+type Options struct {
+	// Token is the Netlify personal access token, taking precedence over
+	// TokenFile and NETLIFY_TOKEN. UseCLIAuth falls back to the token of
+	// the user logged in to the Netlify CLI.
+	Token      string
+	TokenFile  string
+	UseCLIAuth bool
+
+	// APIURL is the base URL of the Netlify API, the public one when empty
+	APIURL  string
+	Account string
+	// CacheDir saves the responses of Netlify to a directory, and Offline
+	// generates zone files from it alone
+	CacheDir string
+	Offline  bool
+	// Since only exports the zones Netlify updated after it, leaving the
+	// files of the others as they are
+	Since time.Time
+	// Concurrency, Timeout, Retries and MaxRecords use the defaults of
+	// ExportOptions and NetlifyDnsClient when 0. A negative MaxRecords
+	// removes the cap.
+	Concurrency int
+	Timeout     time.Duration
+	Retries     int
+	MaxRecords  int
+
+	Zones        []string
+	IncludeTypes []string
+	ExcludeTypes []string
+	// Match and NotMatch select the records to export by hostname
+	Match       *regexp.Regexp
+	NotMatch    *regexp.Regexp
+	SkipManaged bool
+	FailOnEmpty bool
+	FailFast    bool
+
+	// Format is the output format, FormatBind when empty
+	Format string
+	// Stdout prints the zones instead of writing them to files in OutDir,
+	// the current directory when empty, named after the zone name or ID as
+	// FileNaming selects, "name" when empty
+	Stdout     bool
+	OutDir     string
+	FileNaming string
+	SingleFile string
+	DiffPath   string
+	DryRun     bool
+	Strict     bool
+	// Check runs named-checkzone on every zone file when it is installed
+	Check bool
+	// Gzip compresses the output files, adding .gz to the name of each zone's
+	Gzip bool
+
+	// TomlPaths and RedirectsPath name the netlify.toml and _redirects
+	// files to read redirects from, which must exist when set. When empty
+	// the files in the current directory are read if they exist. The rules
+	// of later netlify.toml files take precedence over earlier ones.
+	TomlPaths     []string
+	RedirectsPath string
+
+	UnicodeComments bool
+	AnnotateNetlify bool
+	AnnotateIds     bool
+	FlattenAliases  bool
+	Ttl             int
+	TypeTtls        map[string]int
+	LineEnding      string
+	Class           string
+	NoTimestamp     bool
+	// MetricsPath is the file to write Prometheus metrics about the export
+	// to, none are written when empty
+	MetricsPath string
+
+	// ApplyPath is the zone file to apply to Netlify instead of exporting.
+	// DeleteThreshold is DefaultDeleteThreshold when 0 and allows no
+	// deletions without Confirm when negative.
+	ApplyPath       string
+	Confirm         bool
+	DeleteThreshold int
+
+	ShowVersion bool
+	Verbose     bool
+	Quiet       bool
+	// Progress reports each zone on stderr as its records are fetched,
+	// unless Quiet is set
+	Progress bool
+}
+
+// withDefaults returns o with unset fields replaced by their defaults
+func (o Options) withDefaults() Options {
+	if o.OutDir == "" {
+		o.OutDir = "."
+	}
+	if o.FileNaming == "" {
+		o.FileNaming = "name"
+	}
+	if o.APIURL == "" {
+		o.APIURL = DefaultAPIURL
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.Retries == 0 {
+		o.Retries = DefaultMaxAttempts
+	}
+	if o.LineEnding == "" {
+		o.LineEnding = LineEndingLF
+	}
+	switch {
+	case o.MaxRecords == 0:
+		o.MaxRecords = DefaultMaxRecords
+	case o.MaxRecords < 0:
+		o.MaxRecords = 0
+	}
+	switch {
+	case o.DeleteThreshold == 0:
+		o.DeleteThreshold = DefaultDeleteThreshold
+	case o.DeleteThreshold < 0:
+		o.DeleteThreshold = 0
+	}
+	return o
+}
@@ -0,0 +1,270 @@
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseZoneFile reads the records of a zone file, the inverse of
+// GenerateZoneFile. It understands $ORIGIN, $TTL, @, relative names,
+// inherited owner names and entries spread over several lines with
+// parentheses. Hostnames and names in record data are returned absolute and
+// without trailing dots, as Netlify stores them, and SOA records are skipped
+// since Netlify manages them. Record IDs written by ZoneOptions.AnnotateIds
+// are read back from the "id=" notes of line comments.
+func ParseZoneFile(r io.Reader) ([]DnsRecord, error) {
+	_, records, err := parseZone(r)
+	return records, err
+}
+
+// parseZone is ParseZoneFile also returning the zone's $ORIGIN
+func parseZone(r io.Reader) (string, []DnsRecord, error) {
+	var records []DnsRecord
+	origin, owner := "", ""
+	defaultTtl := 0
+
+	// An entry continues over the following lines while its parentheses
+	// are open
+	var fields []string
+	var id string
+	inheritsOwner := false
+	depth, lineNumber, entryLine := 0, 0, 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+
+		lineFields, comment, err := splitZoneComment(line)
+		if err != nil {
+			return "", nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if depth == 0 {
+			fields, entryLine = lineFields, lineNumber
+			inheritsOwner = startsWithBlank(line)
+			id = ""
+		} else {
+			fields = append(fields, lineFields...)
+		}
+		if commentId := recordIdNote(comment); commentId != "" {
+			id = commentId
+		}
+
+		depth += parenDepth(line)
+		if depth < 0 {
+			return "", nil, fmt.Errorf("line %d: unbalanced parentheses", lineNumber)
+		}
+		if depth > 0 || len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "$ORIGIN":
+			if len(fields) != 2 {
+				return "", nil, fmt.Errorf("line %d: $ORIGIN expects exactly one domain name", entryLine)
+			}
+			origin = strings.TrimSuffix(fields[1], ".")
+			continue
+		case "$TTL":
+			if len(fields) != 2 || !isNumeric(fields[1]) {
+				return "", nil, fmt.Errorf("line %d: $TTL expects a numeric TTL", entryLine)
+			}
+			defaultTtl, _ = strconv.Atoi(fields[1])
+			continue
+		}
+
+		if !inheritsOwner {
+			owner = absoluteName(fields[0], origin)
+			fields = fields[1:]
+		}
+		if owner == "" {
+			return "", nil, fmt.Errorf("line %d: record without an owner name", entryLine)
+		}
+
+		record := DnsRecord{Id: id, Hostname: owner, Ttl: defaultTtl}
+		for i := 0; i < 2 && len(fields) > 0; i++ {
+			if isNumeric(fields[0]) {
+				record.Ttl, _ = strconv.Atoi(fields[0])
+			} else if !recordClasses[strings.ToUpper(fields[0])] {
+				break
+			}
+			fields = fields[1:]
+		}
+		if len(fields) < 2 {
+			return "", nil, fmt.Errorf("line %d: missing record type or data", entryLine)
+		}
+
+		record.Type = strings.ToUpper(fields[0])
+		if record.Type == "SOA" {
+			continue
+		}
+
+		err = parseRecordData(&record, fields[1:], origin)
+		if err != nil {
+			return "", nil, fmt.Errorf("line %d: %w", entryLine, err)
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", nil, fmt.Errorf("error reading zone file: %w", err)
+	}
+	if depth > 0 {
+		return "", nil, fmt.Errorf("line %d: unbalanced parentheses", entryLine)
+	}
+	return origin, records, nil
+}
+
+// recordIdNote returns the record ID in an "id=" note of a line comment,
+// as written by trailingComment, or "" when there is none
+func recordIdNote(comment string) string {
+	for _, note := range strings.Split(comment, ", ") {
+		if id, ok := strings.CutPrefix(strings.TrimSpace(note), "id="); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// parseRecordData fills in the value and type-specific fields of record
+// from the data fields of its line, the inverse of recordData
+func parseRecordData(record *DnsRecord, data []string, origin string) error {
+	expect := func(n int) error {
+		if len(data) != n {
+			return fmt.Errorf("%s record expects %d data fields, got %d", record.Type, n, len(data))
+		}
+		return nil
+	}
+
+	var err error
+	switch record.Type {
+	case "CNAME", "NS", "PTR":
+		if err := expect(1); err != nil {
+			return err
+		}
+		record.Value = absoluteName(data[0], origin)
+	case "MX":
+		if err := expect(2); err != nil {
+			return err
+		}
+		record.Priority, err = strconv.Atoi(data[0])
+		if err != nil {
+			return fmt.Errorf("invalid MX preference %q", data[0])
+		}
+		record.Value = absoluteName(data[1], origin)
+	case "SRV":
+		if err := expect(4); err != nil {
+			return err
+		}
+		numbers := make([]int, 3)
+		for i := range numbers {
+			numbers[i], err = strconv.Atoi(data[i])
+			if err != nil {
+				return fmt.Errorf("invalid SRV field %q", data[i])
+			}
+		}
+		record.Priority, record.Weight, record.Port = numbers[0], &numbers[1], &numbers[2]
+		record.Value = absoluteName(data[3], origin)
+	case "CAA":
+		if err := expect(3); err != nil {
+			return err
+		}
+		flag, tag := data[0], data[1]
+		record.Flag, record.Tag = &flag, &tag
+		record.Value, err = unquoteString(data[2])
+		if err != nil {
+			return err
+		}
+	case "TXT", "SPF":
+		var value strings.Builder
+		for _, chunk := range data {
+			text, err := unquoteString(chunk)
+			if err != nil {
+				return err
+			}
+			value.WriteString(text)
+		}
+		record.Value = value.String()
+	default:
+		record.Value = strings.Join(data, " ")
+	}
+
+	return nil
+}
+
+// parenDepth returns how many parentheses line opens, less the ones it
+// closes, ignoring those in quoted strings and comments
+func parenDepth(line string) int {
+	depth := 0
+	inQuotes := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\':
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == ';':
+			return depth
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		}
+	}
+	return depth
+}
+
+// absoluteName expands a zone file name relative to origin and returns it
+// without its trailing dot
+func absoluteName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.TrimSuffix(name, ".")
+	case origin == "":
+		return name
+	default:
+		return name + "." + origin
+	}
+}
+
+// unquoteString undoes quoteString, also accepting unquoted strings
+func unquoteString(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", fmt.Errorf("unterminated string %s", s)
+	}
+
+	s = s[1 : len(s)-1]
+	var unquoted strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			// \DDD is a decimal byte value
+			if i+2 < len(s) && isDigits(s[i:i+3]) {
+				value, _ := strconv.Atoi(s[i : i+3])
+				unquoted.WriteByte(byte(value))
+				i += 2
+				continue
+			}
+		}
+		unquoted.WriteByte(s[i])
+	}
+	return unquoted.String(), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,61 @@
+package zonefile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseZoneFileRoundTrips(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+		{Hostname: "example.com", Type: "AAAA", Value: "2001:db8::1", Ttl: 3600},
+		{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 3600},
+		{Hostname: "example.com", Type: "TXT", Value: `v=spf1 include:"quoted" -all`, Ttl: 300},
+		{Hostname: "example.com", Type: "CAA", Value: "letsencrypt.org", Flag: stringPtr("0"), Tag: stringPtr("issue"), Ttl: 3600},
+		{Hostname: "www.example.com", Type: "CNAME", Value: "example.netlify.app", Ttl: 300},
+		{Hostname: "sub.example.com", Type: "NS", Value: "ns1.other.net", Ttl: 3600},
+		{Hostname: "_sip._tcp.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(5), Port: intPtr(5060), Ttl: 3600},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseZoneFile(strings.NewReader(zoneFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := sortRecords(records, zone.Name)
+	if got := sortRecords(parsed, zone.Name); !reflect.DeepEqual(got, want) {
+		t.Errorf("got records\n%+v\nwant\n%+v\nfrom:\n%s", got, want, zoneFile)
+	}
+}
+
+func TestParseZoneFileReadsRecordIds(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Id: "5f3a1b2c", Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+		{Id: "5f3a1b2d", Hostname: "example.com", Type: "TXT", Value: "v=spf1 -all; ignored", Ttl: 3600},
+		{Id: "5f3a1b2e", Hostname: "www.example.com", Type: "CNAME", Value: "example.com", Ttl: 3600},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{AnnotateIds: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(zoneFile, "; id=5f3a1b2c\n") {
+		t.Errorf("zone file does not annotate the record IDs:\n%s", zoneFile)
+	}
+	parsed, err := ParseZoneFile(strings.NewReader(zoneFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := sortRecords(records, zone.Name)
+	if got := sortRecords(parsed, zone.Name); !reflect.DeepEqual(got, want) {
+		t.Errorf("got records\n%+v\nwant\n%+v\nfrom:\n%s", got, want, zoneFile)
+	}
+}
@@ -0,0 +1,301 @@
+package zonefile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+type Redirect struct {
+	From   string `toml:"from"`
+	To     string `toml:"to"`
+	Status int    `toml:"status"`
+	Force  bool   `toml:"force"`
+}
+
+type NetlifyToml struct {
+	Redirects []Redirect `toml:"redirects"`
+}
+
+// readNetlifyToml parses the netlify.toml at filePath. Redirect entries that
+// are malformed or incomplete are skipped and described in the returned
+// warnings instead of failing the whole file, and other sections such as
+// [build] and [[headers]] are ignored.
+func readNetlifyToml(filePath string) (NetlifyToml, []string, error) {
+	var config NetlifyToml
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return config, nil, err
+	}
+
+	tree, err := toml.LoadBytes(content)
+	if err != nil {
+		return config, nil, err
+	}
+
+	var warnings []string
+	switch entries := tree.Get("redirects").(type) {
+	case nil:
+	case []*toml.Tree:
+		for i, entry := range entries {
+			var redirect Redirect
+			err := entry.Unmarshal(&redirect)
+			if err == nil {
+				err = validateRedirect(redirect)
+			}
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("skipping redirect %d: %v", i+1, err))
+				continue
+			}
+
+			config.Redirects = append(config.Redirects, redirect)
+		}
+	default:
+		warnings = append(warnings, "ignoring redirects, expected [[redirects]] tables")
+	}
+
+	return config, warnings, nil
+}
+
+// validateRedirect checks that a redirect has a source, a destination and
+// a valid HTTP status
+func validateRedirect(redirect Redirect) error {
+	if strings.TrimSpace(redirect.From) == "" {
+		return errors.New("missing from")
+	}
+	if strings.TrimSpace(redirect.To) == "" {
+		return errors.New("missing to")
+	}
+	if redirect.Status != 0 && (redirect.Status < 100 || redirect.Status > 599) {
+		return fmt.Errorf("invalid status %d", redirect.Status)
+	}
+	return nil
+}
+
+// loadRedirects reads the redirects from the netlify.toml at filePath. A
+// missing file means there are no redirects unless required is set.
+func loadRedirects(filePath string, required bool) ([]Redirect, []string, error) {
+	config, warnings, err := readNetlifyToml(filePath)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+
+	return config.Redirects, warnings, nil
+}
+
+// ParseRedirectsFile parses a Netlify _redirects file. Each line holds a
+// source, optional query parameter matches, a destination, an optional
+// status with a ! suffix forcing it, and optional conditions, which are
+// ignored. Blank lines and # comments are skipped, lines that cannot be
+// parsed are described in the returned warnings.
+func ParseRedirectsFile(r io.Reader) ([]Redirect, []string, error) {
+	var redirects []Redirect
+	var warnings []string
+	scanner := bufio.NewScanner(r)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		redirect := Redirect{From: fields[0]}
+
+		// Query parameter matches such as id=:id sit between from and to
+		rest := fields[1:]
+		for len(rest) > 0 && strings.Contains(rest[0], "=") && !strings.Contains(rest[0], "/") {
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			warnings = append(warnings, fmt.Sprintf("skipping line %d: missing destination", lineNumber))
+			continue
+		}
+		redirect.To = rest[0]
+
+		if len(rest) > 1 {
+			status := rest[1]
+			if strings.HasSuffix(status, "!") {
+				redirect.Force = true
+				status = strings.TrimSuffix(status, "!")
+			}
+
+			code, err := strconv.Atoi(status)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("skipping line %d: invalid status %q", lineNumber, rest[1]))
+				continue
+			}
+			redirect.Status = code
+		}
+
+		if err := validateRedirect(redirect); err != nil {
+			warnings = append(warnings, fmt.Sprintf("skipping line %d: %v", lineNumber, err))
+			continue
+		}
+
+		redirects = append(redirects, redirect)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return redirects, warnings, nil
+}
+
+// mergeRedirects combines the redirects of several netlify.toml files, read
+// in order, so the rules of later files are tried first and override those
+// of earlier ones. Identical rules are only kept once.
+func mergeRedirects(files [][]Redirect) []Redirect {
+	var merged []Redirect
+	seen := make(map[Redirect]bool)
+	for i := len(files) - 1; i >= 0; i-- {
+		for _, redirect := range files[i] {
+			if seen[redirect] {
+				continue
+			}
+			seen[redirect] = true
+			merged = append(merged, redirect)
+		}
+	}
+	return merged
+}
+
+// loadRedirectsFile reads the redirects from the _redirects file at
+// filePath. A missing file means there are no redirects unless required is
+// set.
+func loadRedirectsFile(filePath string, required bool) ([]Redirect, []string, error) {
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	redirects, warnings, err := ParseRedirectsFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	return redirects, warnings, nil
+}
+
+// AppliedRedirect describes a record whose value was replaced by the
+// destination of a redirect, as reported to ZoneOptions.OnRedirect
+type AppliedRedirect struct {
+	Hostname string
+	// From is the From of the matching redirect rule
+	From string
+	// Value is the value written in place of the record's own
+	Value string
+}
+
+// ApplyRedirects returns value rewritten to the destination host of the
+// first host-level redirect that matches hostname, or value itself, and
+// whether a redirect matched. It does not check the record type, which
+// GenerateZoneFile limits to CNAME, NETLIFY and NETLIFYv6 records.
+func ApplyRedirects(hostname, value string, redirects []Redirect) (string, bool) {
+	for _, redirect := range redirects {
+		if !matchRedirectRule(hostname, redirect.From) || !isRedirectStatus(redirect.Status) {
+			continue
+		}
+		if destination, ok := extractDestination(redirect.To); ok {
+			return destination, true
+		}
+	}
+	return value, false
+}
+
+// redirectedValue returns the value of record after applying the first
+// matching host-level redirect through ApplyRedirects, or its own value
+// when none matches, and reports applied redirects to opts
+func redirectedValue(record DnsRecord, redirects []Redirect, opts ZoneOptions) string {
+	if !redirectable(record.Type) {
+		return record.Value
+	}
+
+	// Rules are tried one at a time to know which one matched
+	for i, redirect := range redirects {
+		destination, ok := ApplyRedirects(record.Hostname, record.Value, redirects[i:i+1])
+		if !ok {
+			continue
+		}
+
+		opts.logger().Debug("applying redirect", "hostname", record.Hostname, "from", redirect.From, "to", redirect.To)
+		if opts.OnRedirect != nil {
+			opts.OnRedirect(AppliedRedirect{Hostname: record.Hostname, From: redirect.From, Value: destination})
+		}
+		return destination
+	}
+	return record.Value
+}
+
+// redirectable reports whether records of recordType point at a hostname,
+// which is the only kind of record a redirect can rewrite
+func redirectable(recordType string) bool {
+	return recordType == "CNAME" || recordType == "NETLIFY" || recordType == "NETLIFYv6"
+}
+
+// isRedirectStatus reports whether status makes a rule an actual redirect.
+// Netlify defaults to 301 when no status is given, rewrites (200) and
+// custom error pages keep serving the original host and do not affect DNS.
+func isRedirectStatus(status int) bool {
+	return status == 0 || (status >= 300 && status <= 399)
+}
+
+// Checks if the domain name matches the "from" part of the redirect rule.
+// Only host-level rules affect DNS: the rule must name a host, either
+// exactly or as a *. wildcard for its subdomains, and cover the whole site
+// with an empty, "/" or "/*" path. Path-only and path-specific rules are
+// handled by Netlify and never match.
+func matchRedirectRule(domain, fromRule string) bool {
+	parsedURL, err := url.Parse(fromRule)
+	if err != nil || parsedURL.Host == "" {
+		return false
+	}
+	if !coversWholeSite(parsedURL.Path, "/*") {
+		return false
+	}
+
+	domain = normalizeZoneName(domain)
+	host := normalizeZoneName(parsedURL.Hostname())
+	if strings.HasPrefix(host, "*.") {
+		return strings.HasSuffix(domain, host[1:])
+	}
+	return domain == host
+}
+
+// Extracts the host a DNS record should point at from the "to" part of the
+// redirect rule. The destination must be an absolute URL that keeps the
+// path, either by having none or by forwarding it with :splat, because DNS
+// cannot redirect to a particular path.
+func extractDestination(toRule string) (string, bool) {
+	parsedURL, err := url.Parse(toRule)
+	if err != nil || parsedURL.Host == "" {
+		return "", false
+	}
+	if !coversWholeSite(parsedURL.Path, "/:splat") {
+		return "", false
+	}
+
+	return strings.TrimSuffix(parsedURL.Hostname(), "."), true
+}
+
+// coversWholeSite reports whether a redirect path addresses every path of a
+// host, given the placeholder used on that side of the rule
+func coversWholeSite(path, placeholder string) bool {
+	return path == "" || path == "/" || path == placeholder
+}
@@ -0,0 +1,278 @@
+package zonefile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyRedirects(t *testing.T) {
+	redirects := []Redirect{
+		{From: "https://blog.example.com/*", To: "https://example.com/blog/:splat", Status: 301},
+		{From: "https://old.example.com/*", To: "https://new.example.net/:splat", Status: 301},
+		{From: "https://old.example.com/*", To: "https://newer.example.net/:splat", Status: 301},
+	}
+
+	tests := []struct {
+		name, hostname, want string
+		matched              bool
+	}{
+		{"match", "old.example.com", "new.example.net", true},
+		{"no match", "www.example.com", "site.netlify.app", false},
+		{"path-specific destination", "blog.example.com", "site.netlify.app", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, matched := ApplyRedirects(test.hostname, "site.netlify.app", redirects)
+			if got != test.want || matched != test.matched {
+				t.Errorf("got %q, %v, want %q, %v", got, matched, test.want, test.matched)
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileAppliesRedirects(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "old.example.com", Type: "NETLIFY", Value: "site.netlify.app", Ttl: 300},
+		{Hostname: "www.example.com", Type: "NETLIFY", Value: "site.netlify.app", Ttl: 300},
+		{Hostname: "old.example.com", Type: "TXT", Value: "kept", Ttl: 300},
+	}
+	redirects := []Redirect{{From: "https://old.example.com/*", To: "https://new.example.net/:splat"}}
+
+	var applied []AppliedRedirect
+	zoneFile, err := GenerateZoneFile(zone, records, redirects, ZoneOptions{
+		OnRedirect: func(redirect AppliedRedirect) { applied = append(applied, redirect) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"old\tIN\tCNAME\tnew.example.net.",
+		"old\tIN\tTXT\t\"kept\"",
+		"www\tIN\tCNAME\tsite.netlify.app.",
+	}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+	wantApplied := []AppliedRedirect{{Hostname: "old.example.com", From: "https://old.example.com/*", Value: "new.example.net"}}
+	if !reflect.DeepEqual(applied, wantApplied) {
+		t.Errorf("got applied redirects %+v, want %+v", applied, wantApplied)
+	}
+}
+
+func TestGenerateZoneFileReportsEachAppliedRedirect(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "old.example.com", Type: "CNAME", Value: "site.netlify.app"},
+		{Hostname: "shop.example.com", Type: "NETLIFYv6", Value: "site.netlify.app"},
+		{Hostname: "shop.example.com", Type: "A", Value: "192.0.2.1"},
+		{Hostname: "www.example.com", Type: "NETLIFY", Value: "site.netlify.app"},
+	}
+	redirects := []Redirect{
+		{From: "https://shop.example.com/*", To: "https://store.example.net/:splat", Status: 301},
+		{From: "https://old.example.com/*", To: "https://new.example.net/:splat", Status: 302},
+		{From: "https://old.example.com/*", To: "https://newer.example.net/:splat", Status: 301},
+		{From: "https://www.example.com/*", To: "/index.html", Status: 200},
+	}
+
+	var applied []AppliedRedirect
+	_, err := GenerateZoneFile(zone, records, redirects, ZoneOptions{
+		OnRedirect: func(redirect AppliedRedirect) { applied = append(applied, redirect) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AppliedRedirect{
+		{Hostname: "old.example.com", From: "https://old.example.com/*", Value: "new.example.net"},
+		{Hostname: "shop.example.com", From: "https://shop.example.com/*", Value: "store.example.net"},
+	}
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("got applied redirects %+v, want %+v", applied, want)
+	}
+}
+
+func TestLoadRedirectsFromMissingFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "netlify.toml")
+
+	redirects, warnings, err := loadRedirects(missing, false)
+	if err != nil || redirects != nil || warnings != nil {
+		t.Errorf("got %v, %v, %v for a missing default netlify.toml, want nothing", redirects, warnings, err)
+	}
+
+	if _, _, err := loadRedirects(missing, true); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v for a missing explicit netlify.toml, want fs.ErrNotExist", err)
+	}
+}
+
+func TestRunFailsForMissingTomlPath(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "netlify.toml")
+	stdout, _, err := runZones(t, exampleFetcher(), Options{Stdout: true, TomlPaths: []string{missing}})
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("got error %v, want one naming %s", err, missing)
+	}
+	if stdout != "" {
+		t.Errorf("got output despite the missing netlify.toml:\n%s", stdout)
+	}
+}
+
+func TestMatchRedirectRule(t *testing.T) {
+	tests := []struct {
+		domain, from string
+		want         bool
+	}{
+		{"old.example.com", "https://old.example.com", true},
+		{"old.example.com", "https://old.example.com/*", true},
+		{"OLD.example.com.", "http://old.example.com/", true},
+		{"www.example.com", "https://old.example.com/*", false},
+		{"blog.example.com", "https://*.example.com/*", true},
+		{"a.b.example.com", "https://*.example.com/*", true},
+		{"example.com", "https://*.example.com/*", false},
+		{"old.example.com", "https://old.example.com/blog/*", false},
+		{"old.example.com", "/old/*", false},
+		{"old.example.com", "/*", false},
+	}
+	for _, test := range tests {
+		if got := matchRedirectRule(test.domain, test.from); got != test.want {
+			t.Errorf("matchRedirectRule(%q, %q) = %v, want %v", test.domain, test.from, got, test.want)
+		}
+	}
+}
+
+func TestExtractDestination(t *testing.T) {
+	tests := []struct {
+		to, want string
+		ok       bool
+	}{
+		{"https://new.example.com", "new.example.com", true},
+		{"https://new.example.com/:splat", "new.example.com", true},
+		{"https://new.example.com./", "new.example.com", true},
+		{"https://new.example.com/blog/:splat", "", false},
+		{"/new/:splat", "", false},
+	}
+	for _, test := range tests {
+		got, ok := extractDestination(test.to)
+		if got != test.want || ok != test.ok {
+			t.Errorf("extractDestination(%q) = %q, %v, want %q, %v", test.to, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestReadNetlifyTomlSkipsInvalidRedirects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netlify.toml")
+	content := `[build]
+  command = "npm run build"
+  publish = "dist"
+
+[[headers]]
+  for = "/*"
+  [headers.values]
+    X-Frame-Options = "DENY"
+
+[[redirects]]
+  from = "https://old.example.com/*"
+  to = "https://new.example.com/:splat"
+  status = 301
+  force = true
+
+[[redirects]]
+  from = "https://broken.example.com/*"
+  status = 301
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, warnings, err := readNetlifyToml(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Redirect{{From: "https://old.example.com/*", To: "https://new.example.com/:splat", Status: 301, Force: true}}
+	if !reflect.DeepEqual(config.Redirects, want) {
+		t.Errorf("got redirects %+v, want %+v", config.Redirects, want)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "redirect 2") || !strings.Contains(warnings[0], "missing to") {
+		t.Errorf("got warnings %q, want one about redirect 2 missing its destination", warnings)
+	}
+}
+
+func TestParseRedirectsFile(t *testing.T) {
+	content := `# Redirects for the old domains
+https://old.example.com/* https://new.example.com/:splat 301!
+
+https://legacy.example.com/* https://new.example.com/:splat
+/search q=:query /find/:query 302
+/app/* /index.html 200
+https://broken.example.com/*
+/bad /worse soon
+`
+	redirects, warnings, err := ParseRedirectsFile(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Redirect{
+		{From: "https://old.example.com/*", To: "https://new.example.com/:splat", Status: 301, Force: true},
+		{From: "https://legacy.example.com/*", To: "https://new.example.com/:splat"},
+		{From: "/search", To: "/find/:query", Status: 302},
+		{From: "/app/*", To: "/index.html", Status: 200},
+	}
+	if !reflect.DeepEqual(redirects, want) {
+		t.Errorf("got redirects %+v, want %+v", redirects, want)
+	}
+	wantWarnings := []string{
+		"skipping line 7: missing destination",
+		`skipping line 8: invalid status "soon"`,
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", warnings, wantWarnings)
+	}
+}
+
+func TestRunMergesRedirectsFromSeveralTomlFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.toml")
+	override := filepath.Join(dir, "override.toml")
+	files := map[string]string{
+		base: `[[redirects]]
+from = "https://old.example.com/*"
+to = "https://first.example.net/:splat"
+
+[[redirects]]
+from = "https://shop.example.com/*"
+to = "https://store.example.net/:splat"
+`,
+		override: `[[redirects]]
+from = "https://old.example.com/*"
+to = "https://second.example.net/:splat"
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetcher := &MemoryZoneFetcher{
+		Zones: []DnsZone{{Id: "z1", Name: "example.com"}},
+		Records: map[string][]DnsRecord{"z1": {
+			{Hostname: "old.example.com", Type: "NETLIFY", Value: "site.netlify.app", Ttl: 300},
+			{Hostname: "shop.example.com", Type: "NETLIFY", Value: "site.netlify.app", Ttl: 300},
+		}},
+	}
+	stdout, _, err := runZones(t, fetcher, Options{Stdout: true, TomlPaths: []string{base, override}, NoTimestamp: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"old\tIN\tCNAME\tsecond.example.net.", "shop\tIN\tCNAME\tstore.example.net."}
+	if got := recordLines(t, stdout); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,443 @@
+package zonefile
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationError describes a problem found on one line of a zone file
+type ValidationError struct {
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+var recordClasses = map[string]bool{"IN": true, "CH": true, "HS": true, "CS": true}
+
+var recordTypes = map[string]bool{
+	"A": true, "AAAA": true, "CAA": true, "CNAME": true, "DS": true, "MX": true,
+	"NS": true, "PTR": true, "SOA": true, "SPF": true, "SRV": true, "TLSA": true,
+	"TXT": true,
+}
+
+// nameFields lists, per record type, the positions of the data fields that
+// hold domain names
+var nameFields = map[string][]int{
+	"CNAME": {0},
+	"NS":    {0},
+	"PTR":   {0},
+	"MX":    {1},
+	"SRV":   {3},
+	"SOA":   {0, 1},
+}
+
+// ValidateZoneFile checks contents for mistakes that make DNS servers reject
+// a zone file: domain names that look fully qualified but lack their
+// trailing dot, unknown classes or types, non-numeric TTLs and unbalanced
+// quotes. The error is only set when contents could not be read.
+func ValidateZoneFile(contents string) ([]ValidationError, error) {
+	var problems []ValidationError
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+
+	origin := ""
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+
+		fields, err := splitZoneLine(line)
+		if err != nil {
+			problems = append(problems, ValidationError{lineNumber, err.Error()})
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "$ORIGIN" && len(fields) == 2 {
+			origin = strings.TrimSuffix(fields[1], ".")
+		}
+
+		for _, message := range validateZoneLine(fields, startsWithBlank(line), origin) {
+			problems = append(problems, ValidationError{lineNumber, message})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading zone file: %w", err)
+	}
+	return problems, nil
+}
+
+// validateZoneLine checks the fields of a single directive or record line.
+// inheritsOwner is set when the line starts with a blank, so the first
+// field is not an owner name, and origin is the current $ORIGIN.
+func validateZoneLine(fields []string, inheritsOwner bool, origin string) []string {
+	switch fields[0] {
+	case "$ORIGIN":
+		if len(fields) != 2 {
+			return []string{"$ORIGIN expects exactly one domain name"}
+		}
+		if !strings.HasSuffix(fields[1], ".") {
+			return []string{fmt.Sprintf("$ORIGIN %s is missing its trailing dot", fields[1])}
+		}
+		return nil
+	case "$TTL":
+		if len(fields) != 2 || !isNumeric(fields[1]) {
+			return []string{"$TTL expects a numeric TTL"}
+		}
+		return nil
+	}
+
+	var problems []string
+	rest := fields
+	// Owner names are usually relative to the origin, even with several
+	// labels such as www.staging, so only those repeating the origin are
+	// taken for fully qualified names missing their dot
+	if !inheritsOwner {
+		owner := strings.ToLower(fields[0])
+		repeatsOrigin := origin != "" && (owner == strings.ToLower(origin) || strings.HasSuffix(owner, "."+strings.ToLower(origin)))
+		if message := checkTrailingDot("owner name", fields[0]); message != "" && repeatsOrigin {
+			problems = append(problems, message)
+		}
+		rest = fields[1:]
+	}
+
+	// The TTL and class may appear in either order before the type
+	for i := 0; i < 2 && len(rest) > 0; i++ {
+		token := rest[0]
+		if isNumeric(token) || recordClasses[strings.ToUpper(token)] {
+			rest = rest[1:]
+			continue
+		}
+		if token != "" && token[0] >= '0' && token[0] <= '9' {
+			problems = append(problems, fmt.Sprintf("invalid TTL %q", token))
+			rest = rest[1:]
+			continue
+		}
+		break
+	}
+
+	if len(rest) == 0 {
+		return append(problems, "missing record type")
+	}
+
+	recordType := strings.ToUpper(rest[0])
+	if !recordTypes[recordType] {
+		return append(problems, fmt.Sprintf("unknown record class or type %q", rest[0]))
+	}
+
+	data := rest[1:]
+	if len(data) == 0 {
+		return append(problems, fmt.Sprintf("%s record has no data", recordType))
+	}
+	for _, position := range nameFields[recordType] {
+		if position < len(data) {
+			if message := checkTrailingDot(recordType+" target", data[position]); message != "" {
+				problems = append(problems, message)
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkTrailingDot reports names that contain several labels, and so are
+// most likely meant to be fully qualified, but do not end in a dot
+func checkTrailingDot(what, name string) string {
+	if name == "@" || strings.HasSuffix(name, ".") || !strings.Contains(name, ".") {
+		return ""
+	}
+	return fmt.Sprintf("%s %s looks fully qualified but is missing its trailing dot", what, name)
+}
+
+// splitZoneLine splits a zone file line into whitespace-separated fields,
+// keeping quoted strings (including their quotes) as single fields and
+// dropping comments and parentheses
+func splitZoneLine(line string) ([]string, error) {
+	fields, _, err := splitZoneComment(line)
+	return fields, err
+}
+
+// splitZoneComment is splitZoneLine also returning the comment ending the
+// line, without its semicolon
+func splitZoneComment(line string) ([]string, string, error) {
+	var fields []string
+	var field strings.Builder
+	inQuotes, inField := false, false
+
+	flush := func() {
+		if inField {
+			fields = append(fields, field.String())
+			field.Reset()
+			inField = false
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			field.WriteByte(c)
+			field.WriteByte(line[i+1])
+			inField = true
+			i++
+		case c == '"':
+			field.WriteByte(c)
+			inField = true
+			inQuotes = !inQuotes
+		case inQuotes:
+			field.WriteByte(c)
+		case c == ';':
+			flush()
+			return fields, strings.TrimSpace(line[i+1:]), nil
+		case c == ' ' || c == '\t' || c == '(' || c == ')':
+			flush()
+		default:
+			field.WriteByte(c)
+			inField = true
+		}
+	}
+
+	if inQuotes {
+		return nil, "", fmt.Errorf("unbalanced quotes")
+	}
+	flush()
+	return fields, "", nil
+}
+
+func startsWithBlank(line string) bool {
+	return line != "" && (line[0] == ' ' || line[0] == '\t')
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 32)
+	return err == nil
+}
+
+// maxNameLen and maxLabelLen are the longest domain name, in its textual form
+// without the trailing dot (255 bytes on the wire), and the longest label
+const (
+	maxNameLen  = 253
+	maxLabelLen = 63
+)
+
+// validateHostname checks that name can be written as an owner name: labels
+// of 1 to 63 letters, digits, hyphens and underscores, not starting or
+// ending with a hyphen, a leading * label for wildcards and at most 253
+// characters in total
+func validateHostname(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > maxNameLen {
+		return fmt.Errorf("hostname %s is longer than %d characters", name, maxNameLen)
+	}
+
+	for i, label := range strings.Split(name, ".") {
+		switch {
+		case label == "":
+			return fmt.Errorf("hostname %q has an empty label", name)
+		case len(label) > maxLabelLen:
+			return fmt.Errorf("hostname %s has a label longer than %d characters", name, maxLabelLen)
+		case label == "*" && i == 0:
+			continue
+		case strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-"):
+			return fmt.Errorf("hostname %s has a label starting or ending with a hyphen", name)
+		}
+
+		for _, c := range label {
+			if !isLabelChar(c) {
+				return fmt.Errorf("hostname %q contains the invalid character %q", name, c)
+			}
+		}
+	}
+	return nil
+}
+
+func isLabelChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+// validateAddress checks that the value of an A record is an IPv4 address
+// and that of an AAAA record an IPv6 address. Other types are not checked.
+func validateAddress(recordType, value string) error {
+	if recordType != "A" && recordType != "AAAA" {
+		return nil
+	}
+
+	ip := net.ParseIP(value)
+	switch {
+	case ip == nil:
+		return fmt.Errorf("%s record value %q is not an IP address", recordType, value)
+	case recordType == "A" && ip.To4() == nil:
+		return fmt.Errorf("A record value %s is an IPv6 address, use an AAAA record", value)
+	case recordType == "AAAA" && ip.To4() != nil:
+		return fmt.Errorf("AAAA record value %s is an IPv4 address, use an A record", value)
+	}
+	return nil
+}
+
+// validateRecordData checks the data of the record types whose value packs
+// several fields: CAA, DS and TLSA. Other types are not checked.
+func validateRecordData(record DnsRecord) error {
+	switch record.Type {
+	case "CAA":
+		return validateCAA(record)
+	case "DS":
+		return validateDS(record.Value)
+	case "TLSA":
+		return validateTLSA(record.Value)
+	}
+	return nil
+}
+
+// caaTags are the CAA property tags defined by RFC 8659
+var caaTags = map[string]bool{"issue": true, "issuewild": true, "iodef": true}
+
+// validateCAA checks that the flag of a CAA record is a number from 0 to
+// 255, that its tag is one of issue, issuewild and iodef, and that the value
+// of an iodef record is a mailto: or http(s) URL. Other types are not
+// checked, and an empty flag or tag stands for the 0 and issue written in
+// their place.
+func validateCAA(record DnsRecord) error {
+	if record.Type != "CAA" {
+		return nil
+	}
+
+	if flag := stringOrEmpty(record.Flag); flag != "" {
+		if _, err := strconv.ParseUint(flag, 10, 8); err != nil {
+			return fmt.Errorf("CAA record flag %q is not a number from 0 to 255", flag)
+		}
+	}
+
+	tag := strings.ToLower(stringOrEmpty(record.Tag))
+	if tag == "" {
+		return nil
+	}
+	if !caaTags[tag] {
+		return fmt.Errorf("CAA record tag %q is not one of issue, issuewild and iodef", tag)
+	}
+
+	if tag == "iodef" {
+		u, err := url.Parse(record.Value)
+		if err != nil || (u.Scheme != "mailto" && u.Scheme != "http" && u.Scheme != "https") || (u.Opaque == "" && u.Host == "") {
+			return fmt.Errorf("CAA iodef value %q is not a mailto: or http(s) URL", record.Value)
+		}
+	}
+	return nil
+}
+
+// cnameConflicts reports every name with a CNAME record alongside records
+// of other types, which DNS forbids, and CNAME records at the apex, which
+// always holds the SOA and NS records, unless apexCNAME allows them for a
+// provider flattening them. nameTypes maps the hostnames of the zone to the
+// types of their records.
+func cnameConflicts(zoneName string, nameTypes map[string][]string, apexCNAME bool) []error {
+	var names []string
+	for name := range nameTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []error
+	for _, name := range names {
+		hasCname := false
+		var others []string
+		for _, recordType := range nameTypes[name] {
+			if recordType == "CNAME" {
+				hasCname = true
+			} else {
+				others = append(others, recordType)
+			}
+		}
+
+		apex := normalizeZoneName(name) == normalizeZoneName(zoneName)
+		switch {
+		case !hasCname, apex && apexCNAME:
+		case apex:
+			problems = append(problems, fmt.Errorf("%s has a CNAME record at the zone apex, which holds the SOA and NS records", name))
+		case len(others) > 0:
+			problems = append(problems, fmt.Errorf("%s has a CNAME record along with %s records", name, strings.Join(others, ", ")))
+		}
+	}
+	return problems
+}
+
+// dsDigestLengths are the digest lengths, in bytes, of the DS digest types
+// in use: SHA-1, SHA-256 and SHA-384
+var dsDigestLengths = map[uint64]int{1: 20, 2: 32, 4: 48}
+
+// validateDS checks that the value of a DS record holds a key tag from 0 to
+// 65535, an algorithm and a digest type from 0 to 255 and a hex digest, of
+// the right length for the digest types with a known length
+func validateDS(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return fmt.Errorf("DS record value %q does not hold a key tag, algorithm, digest type and digest", value)
+	}
+
+	if _, err := strconv.ParseUint(fields[0], 10, 16); err != nil {
+		return fmt.Errorf("DS record key tag %q is not a number from 0 to 65535", fields[0])
+	}
+	if _, err := strconv.ParseUint(fields[1], 10, 8); err != nil {
+		return fmt.Errorf("DS record algorithm %q is not a number from 0 to 255", fields[1])
+	}
+	digestType, err := strconv.ParseUint(fields[2], 10, 8)
+	if err != nil {
+		return fmt.Errorf("DS record digest type %q is not a number from 0 to 255", fields[2])
+	}
+
+	digest, err := hex.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return fmt.Errorf("DS record digest is not hexadecimal: %w", err)
+	}
+	if length, ok := dsDigestLengths[digestType]; ok && len(digest) != length {
+		return fmt.Errorf("DS record digest is %d bytes long, digest type %d expects %d", len(digest), digestType, length)
+	}
+	return nil
+}
+
+// validateTLSA checks that the value of a TLSA record holds a certificate
+// usage from 0 to 3, a selector of 0 or 1, a matching type from 0 to 2 and
+// hex certificate association data, of the right length for the SHA-256
+// and SHA-512 matching types
+func validateTLSA(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return fmt.Errorf("TLSA record value %q does not hold a usage, selector, matching type and certificate association data", value)
+	}
+
+	limits := []struct {
+		name string
+		max  uint64
+	}{{"usage", 3}, {"selector", 1}, {"matching type", 2}}
+	var matchingType uint64
+	for i, limit := range limits {
+		n, err := strconv.ParseUint(fields[i], 10, 8)
+		if err != nil || n > limit.max {
+			return fmt.Errorf("TLSA record %s %q is not a number from 0 to %d", limit.name, fields[i], limit.max)
+		}
+		matchingType = n
+	}
+
+	data, err := hex.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return fmt.Errorf("TLSA record certificate association data is not hexadecimal: %w", err)
+	}
+	if length, ok := tlsaDataLengths[matchingType]; ok && len(data) != length {
+		return fmt.Errorf("TLSA record certificate association data is %d bytes long, matching type %d expects %d", len(data), matchingType, length)
+	}
+	return nil
+}
+
+// tlsaDataLengths are the lengths, in bytes, of the hashes TLSA matching
+// types 1 and 2 hold
+var tlsaDataLengths = map[uint64]int{1: 32, 2: 64}
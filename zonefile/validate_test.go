@@ -0,0 +1,86 @@
+package zonefile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateZoneFileAcceptsRelativeOwnerNames(t *testing.T) {
+	zoneFile := strings.Join([]string{
+		"$ORIGIN example.com.",
+		"$TTL 3600",
+		"@\tIN\tA\t192.0.2.1",
+		"www\tIN\tCNAME\texample.com.",
+		"www.staging\tIN\tA\t192.0.2.2",
+		"_443._tcp.www\tIN\tTLSA\t3\t1\t1\tabcdef",
+		"",
+	}, "\n")
+
+	problems, err := ValidateZoneFile(zoneFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("got problems %v, want none", problems)
+	}
+}
+
+func TestValidateZoneFileReportsOwnerNamesRepeatingTheOrigin(t *testing.T) {
+	zoneFile := "$ORIGIN example.com.\nwww.example.com\tIN\tA\t192.0.2.1\n"
+
+	problems, err := ValidateZoneFile(zoneFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Line != 2 || !strings.Contains(problems[0].Message, "www.example.com") {
+		t.Errorf("got problems %v, want one for www.example.com on line 2", problems)
+	}
+}
+
+func TestValidateZoneFileAcceptsGeneratedZoneFiles(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+		{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 3600},
+		{Hostname: "example.com", Type: "TXT", Value: "v=spf1 include:example.net -all", Ttl: 3600},
+		{Hostname: "www.example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 300},
+		{Hostname: "_sip._tcp.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(5), Port: intPtr(5060), Ttl: 300},
+	}
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := ValidateZoneFile(zoneFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("got problems %v in:\n%s", problems, zoneFile)
+	}
+}
+
+func TestValidateZoneFileReportsMalformedLines(t *testing.T) {
+	zoneFile := strings.Join([]string{
+		"$ORIGIN example.com.",
+		"$TTL 3600",
+		"@\tIN\tA\t192.0.2.1",
+		"www\tIN\tBOGUS\t192.0.2.1",
+		"mail\tIN\tsoon\tA\t192.0.2.2",
+		"txt\tIN\tTXT\t\"unterminated",
+		"",
+	}, "\n")
+
+	problems, err := ValidateZoneFile(zoneFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, problem := range problems {
+		lines = append(lines, problem.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{4, 5, 6}) {
+		t.Errorf("got problems %v, want one on each of lines 4, 5 and 6", problems)
+	}
+}
@@ -0,0 +1,2192 @@
+// Package zonefile exports the DNS zones and records of a Netlify account
+// as BIND zone files and other formats. ExportZones and GenerateZoneFile
+// are the entry points for Go programs, while Run is the whole command line
+// tool driven by Options.
+package zonefile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// DefaultAPIURL is the default base URL of the Netlify API
+const DefaultAPIURL string = "https://api.netlify.com/api/v1/"
+
+// Version is the tool version written to zone file headers and the
+// User-Agent. It, Commit and BuildDate are set at build time with -ldflags
+// "-X github.com/devindford/netlify-dns-zone-file/zonefile.Version=...",
+// and likewise for the others.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// versionString describes the build for -version, falling back to the VCS
+// details the Go toolchain records when Commit and BuildDate are unset
+func versionString() string {
+	revision, date := Commit, BuildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && revision == "":
+				revision = setting.Value
+			case setting.Key == "vcs.time" && date == "":
+				date = setting.Value
+			}
+		}
+	}
+
+	description := "netlify-dns-zone-file " + Version
+	if revision != "" {
+		description += " commit " + revision
+	}
+	if date != "" {
+		description += " built " + date
+	}
+	return description
+}
+
+type DnsZone struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// UpdatedAt is when Netlify last changed the zone
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type DnsRecord struct {
+	Id        string  `json:"id"`
+	DnsZoneId string  `json:"dns_zone_id"`
+	Hostname  string  `json:"hostname"`
+	Type      string  `json:"type"`
+	Ttl       int     `json:"ttl"`
+	Priority  int     `json:"priority"`
+	Weight    *int    `json:"weight,omitempty"`
+	Port      *int    `json:"port,omitempty"`
+	Flag      *string `json:"flag,omitempty"`
+	Tag       *string `json:"tag,omitempty"`
+	Managed   bool    `json:"managed"`
+	Value     string  `json:"value"`
+}
+
+// APIError is returned when the Netlify API answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Endpoint   string
+	Body       string
+}
+
+// ErrNotFound matches, through errors.Is, the APIError returned when the
+// requested zone or record does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrUnauthorized is matched by API errors for a token that Netlify rejects
+// or that may not access the requested resource
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrResponseTooLarge is returned when a response body is larger than the
+// client accepts, see WithMaxResponseSize
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// maxErrorBodyLen limits how much of an error response is kept in an APIError
+const maxErrorBodyLen = 300
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s (%d) on %s", strings.ToLower(http.StatusText(e.StatusCode)), e.StatusCode, e.Endpoint)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// NetlifyDnsClient calls the DNS endpoints of the Netlify API. It is safe for
+// concurrent use, and copies of a client share its HTTP client and rate limit.
+type NetlifyDnsClient struct {
+	client    *http.Client
+	token     string
+	baseURL   string
+	userAgent string
+	// accountSlug limits GetAllDnsZones to the zones of one team
+	accountSlug string
+
+	maxAttempts    int
+	retryBaseDelay time.Duration
+	// maxRecords caps the records GetAllDnsRecords fetches for one zone
+	maxRecords int
+	// maxResponseSize caps the bytes read from a response body
+	maxResponseSize int64
+	// perPage is the page size asked of list endpoints
+	perPage int
+
+	rateLimit *rateLimiter
+	logger    *slog.Logger
+}
+
+// rateLimiter delays requests once Netlify reports that fewer than
+// threshold requests remain in the current rate-limit window. It is shared
+// by copies of a client.
+type rateLimiter struct {
+	threshold int
+
+	mu       sync.Mutex
+	resumeAt time.Time
+}
+
+// wait blocks until the current rate-limit window has reset, if needed
+func (r *rateLimiter) wait(ctx context.Context) error {
+	r.mu.Lock()
+	delay := time.Until(r.resumeAt)
+	r.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// update records the X-RateLimit-Remaining and X-RateLimit-Reset headers of
+// a response
+func (r *rateLimiter) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil || remaining >= r.threshold {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.resumeAt = time.Unix(reset, 0)
+	r.mu.Unlock()
+}
+
+const (
+	DefaultTimeout            = 30 * time.Second
+	defaultRateLimitThreshold = 5
+
+	DefaultMaxAttempts    = 4
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	maxRetryDelay         = 30 * time.Second
+
+	// DefaultMaxRecords is far above what a real zone holds, it only stops
+	// a runaway pagination loop
+	DefaultMaxRecords = 100000
+	// defaultMaxResponseSize bounds the memory a single response may take,
+	// far above the size of a page of records
+	defaultMaxResponseSize = 8 << 20
+
+	// defaultPerPage is the page size asked of list endpoints, and
+	// maxPerPage the most items Netlify returns in one page
+	defaultPerPage = 100
+	maxPerPage     = 100
+)
+
+// ClientOption configures a NetlifyDnsClient created by NewNetlifyDnsClient
+type ClientOption func(*NetlifyDnsClient)
+
+// WithBaseURL points the client at a Netlify-compatible API other than the
+// public one, such as a proxy or a test server
+func WithBaseURL(baseURL string) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		n.baseURL = strings.TrimSuffix(baseURL, "/") + "/"
+	}
+}
+
+// WithTimeout limits how long a single HTTP request may take, including
+// reading the response body
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		n.client.Timeout = timeout
+	}
+}
+
+// WithUserAgent replaces the User-Agent sent with every request, which is
+// netlify-zone-file/<version> by default
+func WithUserAgent(userAgent string) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		n.userAgent = userAgent
+	}
+}
+
+// WithAccountSlug limits GetAllDnsZones to the zones of the Netlify team
+// with the given slug, see validAccountSlug
+func WithAccountSlug(slug string) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		n.accountSlug = slug
+	}
+}
+
+// validAccountSlug reports whether slug looks like a Netlify team slug:
+// lowercase letters, digits and hyphens
+func validAccountSlug(slug string) bool {
+	if slug == "" {
+		return false
+	}
+	for _, c := range slug {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// WithTransport makes the client send its requests through transport, for
+// example one with a custom proxy or TLS configuration. By default
+// http.DefaultTransport is used, which honours HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		n.client.Transport = transport
+	}
+}
+
+// WithRetries sets how many times a request is attempted in total before
+// giving up on 429 and 5xx responses, and the delay before the first retry
+func WithRetries(maxAttempts int, baseDelay time.Duration) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		if maxAttempts < 1 {
+			maxAttempts = 1
+		}
+		n.maxAttempts = maxAttempts
+		n.retryBaseDelay = baseDelay
+	}
+}
+
+// WithRateLimitThreshold makes the client pause until the rate-limit window
+// resets once fewer than threshold requests remain. 0 disables throttling.
+func WithRateLimitThreshold(threshold int) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		n.rateLimit.threshold = threshold
+	}
+}
+
+// WithMaxRecords makes GetAllDnsRecords fail once a zone has more than
+// maxRecords records instead of fetching further pages. 0 removes the cap.
+func WithMaxRecords(maxRecords int) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		n.maxRecords = maxRecords
+	}
+}
+
+// WithMaxResponseSize makes requests fail with ErrResponseTooLarge when a
+// response body is larger than maxBytes, instead of reading it all into
+// memory
+func WithMaxResponseSize(maxBytes int64) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		n.maxResponseSize = maxBytes
+	}
+}
+
+// WithPerPage sets how many zones or records the client asks for in each
+// page of a list, capped at maxPerPage. Values below 1 use defaultPerPage.
+func WithPerPage(perPage int) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		switch {
+		case perPage < 1:
+			perPage = defaultPerPage
+		case perPage > maxPerPage:
+			perPage = maxPerPage
+		}
+		n.perPage = perPage
+	}
+}
+
+// WithLogger makes the client log its retries to logger at debug level
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(n *NetlifyDnsClient) {
+		n.logger = logger
+	}
+}
+
+// Line endings of ZoneOptions.LineEnding
+const (
+	LineEndingLF   = "lf"
+	LineEndingCRLF = "crlf"
+)
+
+// SerialStrategy selects how the SOA serial is derived when ZoneOptions.Serial is unset
+type SerialStrategy string
+
+const (
+	// SerialDate, the default, uses the YYYYMMDDnn convention with the UTC
+	// date of ZoneOptions.GeneratedAt, or the current one when unset, and a
+	// counter of 01, since no state is kept between runs
+	SerialDate SerialStrategy = "date"
+	// SerialContentHash hashes the sorted record lines so the serial only
+	// changes when the zone content does. The hash can be lower than the
+	// previous one, which secondaries take as an older zone, so it only
+	// suits zones that are not transferred
+	SerialContentHash SerialStrategy = "content-hash"
+)
+
+// ZoneOptions controls how GenerateZoneFile writes a zone file. Zero values
+// are replaced by defaults, matching Netlify's (NS1) for the SOA fields.
+type ZoneOptions struct {
+	PrimaryNameserver string
+	AdminEmail        string
+	Serial            uint32
+	SerialStrategy    SerialStrategy
+	Refresh           int
+	Retry             int
+	Expire            int
+	Minimum           int
+
+	// DefaultTtl is written as the $TTL directive, when unset the most
+	// common TTL among the records is used
+	DefaultTtl int
+
+	// OmitSOA and OmitApexNS leave out the records that a DNS provider
+	// generates itself when a zone is imported
+	OmitSOA    bool
+	OmitApexNS bool
+	// ApexCNAME keeps apex NETLIFY and NETLIFYv6 records as CNAME records,
+	// for providers that flatten them such as Cloudflare. They are left out
+	// with a warning otherwise, since DNS allows no CNAME at the apex.
+	ApexCNAME bool
+
+	// UnicodeComments follows names that had to be converted to punycode
+	// with a comment holding their Unicode form
+	UnicodeComments bool
+
+	// Ttl replaces the TTL of every record and TypeTtls, keyed by record
+	// type, that of records of the listed types. Records without a TTL
+	// keep using the zone's default
+	Ttl      int
+	TypeTtls map[string]int
+
+	// Strict makes an error of records with invalid hostnames and of SRV
+	// records without _service._proto labels, which are otherwise skipped
+	// with a warning, and of CNAME records sharing their name with other
+	// records or at the apex, which are otherwise written with a warning.
+	// It also skips A and AAAA records whose value is not an address of
+	// their family, and CAA, DS and TLSA records with invalid data, which
+	// are otherwise written with a warning.
+	Strict bool
+
+	// LineEnding is LineEndingLF, the default, or LineEndingCRLF
+	LineEnding string
+	// Class is the class of every record, IN by default, or one of CH, HS
+	// and CS
+	Class string
+
+	// GeneratedAt is written to the header comment, which leaves the time
+	// out when it is zero so output stays deterministic
+	GeneratedAt time.Time
+	// AnnotateNetlify follows NETLIFY and NETLIFYv6 records, which are
+	// written as CNAME records, with a "; netlify-managed (TYPE)" comment
+	AnnotateNetlify bool
+	// AnnotateIds ends each record line with a "; id=ID" comment holding
+	// the Netlify record ID, which ParseZoneFile reads back
+	AnnotateIds bool
+
+	// Logger receives notes about skipped records and applied redirects,
+	// nothing is logged when it is nil
+	Logger *slog.Logger
+
+	// OnRedirect, when set, is called for every record a redirect rewrites,
+	// so callers can report them
+	OnRedirect func(AppliedRedirect)
+}
+
+// overrideTtls returns records with the TTL overrides of o applied
+func (o ZoneOptions) overrideTtls(records []DnsRecord) []DnsRecord {
+	if o.Ttl == 0 && len(o.TypeTtls) == 0 {
+		return records
+	}
+
+	overridden := make([]DnsRecord, len(records))
+	for i, record := range records {
+		if record.Ttl != 0 {
+			if ttl, ok := o.TypeTtls[record.Type]; ok {
+				record.Ttl = ttl
+			} else if o.Ttl != 0 {
+				record.Ttl = o.Ttl
+			}
+		}
+		overridden[i] = record
+	}
+	return overridden
+}
+
+// canonicalTypeTtls returns ttls keyed by record types as Netlify spells
+// them, which is how overrideTtls looks them up
+func canonicalTypeTtls(ttls map[string]int) (map[string]int, error) {
+	canonical := make(map[string]int, len(ttls))
+	for name, ttl := range ttls {
+		recordType, err := ParseRecordType(name)
+		if err != nil {
+			return nil, fmt.Errorf("-ttl-type: %w", err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("-ttl-type: TTL for %s must be a positive number of seconds, got %d", recordType, ttl)
+		}
+		canonical[recordType] = ttl
+	}
+	return canonical, nil
+}
+
+func (o ZoneOptions) logger() *slog.Logger {
+	if o.Logger == nil {
+		return discardLogger
+	}
+	return o.Logger
+}
+
+func (o ZoneOptions) withDefaults() ZoneOptions {
+	if o.PrimaryNameserver == "" {
+		o.PrimaryNameserver = "dns1.p01.nsone.net."
+	}
+	if o.AdminEmail == "" {
+		o.AdminEmail = "hostmaster@nsone.net"
+	}
+	if o.LineEnding == "" {
+		o.LineEnding = LineEndingLF
+	}
+	if o.Class == "" {
+		o.Class = "IN"
+	}
+	if o.SerialStrategy == "" {
+		o.SerialStrategy = SerialDate
+	}
+	if o.Refresh == 0 {
+		o.Refresh = 43200
+	}
+	if o.Retry == 0 {
+		o.Retry = 7200
+	}
+	if o.Expire == 0 {
+		o.Expire = 1209600
+	}
+	if o.Minimum == 0 {
+		o.Minimum = 3600
+	}
+	return o
+}
+
+// zoneSerial computes the SOA serial for the given record lines, generated
+// at now or the current time when it is zero
+func zoneSerial(strategy SerialStrategy, recordLines []string, now time.Time) (uint32, error) {
+	switch strategy {
+	case SerialDate:
+		if now.IsZero() {
+			now = time.Now()
+		}
+		now = now.UTC()
+		return uint32(now.Year()*1000000+int(now.Month())*10000+now.Day()*100) + 1, nil
+	case SerialContentHash:
+		sorted := append([]string(nil), recordLines...)
+		sort.Strings(sorted)
+
+		hash := fnv.New32a()
+		for _, line := range sorted {
+			hash.Write([]byte(line))
+			hash.Write([]byte{'\n'})
+		}
+		return hash.Sum32(), nil
+	default:
+		return 0, fmt.Errorf("unknown serial strategy %q", strategy)
+	}
+}
+
+// soaMailbox converts an email address to the domain-name form used in
+// SOA records, escaping dots in the local part
+func soaMailbox(email string) string {
+	if !strings.Contains(email, "@") {
+		return fqdn(email)
+	}
+	local, domain, _ := strings.Cut(email, "@")
+	return strings.ReplaceAll(local, ".", "\\.") + "." + fqdn(domain)
+}
+
+func NewNetlifyDnsClient(token string, opts ...ClientOption) NetlifyDnsClient {
+	client := &http.Client{Timeout: DefaultTimeout, Transport: http.DefaultTransport}
+
+	n := NetlifyDnsClient{
+		client:          client,
+		token:           token,
+		baseURL:         DefaultAPIURL,
+		userAgent:       "netlify-zone-file/" + Version,
+		maxAttempts:     DefaultMaxAttempts,
+		retryBaseDelay:  defaultRetryBaseDelay,
+		maxRecords:      DefaultMaxRecords,
+		maxResponseSize: defaultMaxResponseSize,
+		perPage:         defaultPerPage,
+		rateLimit:       &rateLimiter{threshold: defaultRateLimitThreshold},
+		logger:          discardLogger,
+	}
+	for _, opt := range opts {
+		opt(&n)
+	}
+	return n
+}
+
+func (n *NetlifyDnsClient) addCommonHeaders(req *http.Request) {
+	req.Header.Add("Authorization", "Bearer "+n.token)
+	req.Header.Set("User-Agent", n.userAgent)
+}
+
+func (n *NetlifyDnsClient) getReqByteSlice(ctx context.Context, endpoint string) ([]byte, http.Header, error) {
+	return n.doWithRetries(ctx, "GET", endpoint)
+}
+
+// doWithRetries issues an idempotent, bodiless request for endpoint,
+// retrying transient failures with exponential backoff up to the client's
+// maximum number of attempts
+func (n *NetlifyDnsClient) doWithRetries(ctx context.Context, method, endpoint string) ([]byte, http.Header, error) {
+	for attempt := 1; ; attempt++ {
+		body, header, err := n.doOnce(ctx, method, endpoint, nil)
+		if err == nil || attempt >= n.maxAttempts || !isRetryable(ctx, err) {
+			return body, header, err
+		}
+
+		delay := backoffDelay(n.retryBaseDelay, attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+			if retryAfter, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+		}
+
+		n.logger.Debug("retrying request", "method", method, "endpoint", endpoint, "attempt", attempt, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("error doing %s request: %w", strings.ToLower(method), ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// doOnce performs a single request for endpoint, sending payload as a JSON
+// body when it is not nil. The response header is returned even for non-2xx
+// responses so callers can inspect Retry-After.
+func (n *NetlifyDnsClient) doOnce(ctx context.Context, method, endpoint string, payload []byte) ([]byte, http.Header, error) {
+	reqUrl := endpoint
+	if !strings.HasPrefix(endpoint, "https://") && !strings.HasPrefix(endpoint, "http://") {
+		reqUrl = n.baseURL + endpoint
+	}
+
+	kind := strings.ToLower(method)
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, reqBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating %s request: %w", kind, err)
+	}
+	n.addCommonHeaders(req)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	err = n.rateLimit.wait(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error waiting for rate limit reset: %w", err)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error doing %s request: %w", kind, err)
+	}
+	n.rateLimit.update(resp.Header)
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, n.maxResponseSize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %s request body: %w", kind, err)
+	}
+	if int64(len(body)) > n.maxResponseSize {
+		return nil, nil, fmt.Errorf("%w: %s returned more than %d bytes", ErrResponseTooLarge, n.endpointPath(req.URL), n.maxResponseSize)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if len(body) > maxErrorBodyLen {
+			body = body[:maxErrorBodyLen]
+		}
+		return nil, resp.Header, &APIError{
+			StatusCode: resp.StatusCode,
+			Endpoint:   n.endpointPath(req.URL),
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+
+	return body, resp.Header, nil
+}
+
+// endpointPath returns the path of a request URL relative to the base URL
+// of the client, as errors name endpoints, leaving out the host and the
+// query with its page parameters
+func (n *NetlifyDnsClient) endpointPath(reqUrl *url.URL) string {
+	path := reqUrl.Path
+	if base, err := url.Parse(n.baseURL); err == nil {
+		path = strings.TrimPrefix(path, base.Path)
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+// isRetryable reports whether a failed request may succeed when repeated:
+// rate limiting, server errors and transport errors are, other 4xx and
+// cancellation are not
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrResponseTooLarge) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return true
+}
+
+// backoffDelay returns the wait before retry number attempt, doubling the
+// base delay each time and adding up to 50% of random jitter
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base << (attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// getAllPages requests endpoint, asking for pages of the client's page
+// size, and then every page linked from it through the Link header, passing
+// each response body to handlePage in order. Links to other hosts than the
+// API's are refused, as they would be sent the token.
+func (n *NetlifyDnsClient) getAllPages(ctx context.Context, endpoint string, handlePage func(body []byte) error) error {
+	if n.perPage > 0 {
+		separator := "?"
+		if strings.Contains(endpoint, "?") {
+			separator = "&"
+		}
+		endpoint += separator + "per_page=" + strconv.Itoa(n.perPage)
+	}
+
+	for endpoint != "" {
+		body, header, err := n.getReqByteSlice(ctx, endpoint)
+		if err != nil {
+			return err
+		}
+
+		err = handlePage(body)
+		if err != nil {
+			return err
+		}
+
+		endpoint, err = n.apiURL(nextPageUrl(header))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apiURL resolves link against the base URL of the client, returning an
+// error when it points to another host. An empty link stays empty.
+func (n *NetlifyDnsClient) apiURL(link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+
+	base, err := url.Parse(n.baseURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing API base URL: %w", err)
+	}
+	target, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("error parsing next page link %q: %w", link, err)
+	}
+	resolved := base.ResolveReference(target)
+	if resolved.Scheme != base.Scheme || !strings.EqualFold(resolved.Host, base.Host) {
+		return "", fmt.Errorf("refusing to follow next page link %q to another host than %s", link, base.Host)
+	}
+	return resolved.String(), nil
+}
+
+// nextPageUrl returns the URL of the rel="next" entry in the Link header,
+// or an empty string when there are no more pages
+func nextPageUrl(header http.Header) string {
+	for _, link := range header.Values("Link") {
+		for _, entry := range strings.Split(link, ",") {
+			parts := strings.Split(entry, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				if strings.TrimSpace(param) == `rel="next"` {
+					return strings.Trim(target, "<>")
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+func (n *NetlifyDnsClient) GetAllDnsZones(ctx context.Context) ([]DnsZone, error) {
+	endpoint := "dns_zones"
+	if n.accountSlug != "" {
+		endpoint += "?account_slug=" + url.QueryEscape(n.accountSlug)
+	}
+
+	var dnsZones []DnsZone
+	err := n.getAllPages(ctx, endpoint, func(body []byte) error {
+		var page []DnsZone
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return fmt.Errorf("error unmarshalling get request body: %w", err)
+		}
+
+		dnsZones = append(dnsZones, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dnsZones, nil
+}
+
+// CheckToken makes sure Netlify accepts the token for the DNS API by listing
+// a single zone, so a bad token fails fast instead of deep into an export.
+// A rejected token returns an error matching ErrUnauthorized.
+func (n *NetlifyDnsClient) CheckToken(ctx context.Context) error {
+	endpoint := "dns_zones?per_page=1"
+	if n.accountSlug != "" {
+		endpoint += "&account_slug=" + url.QueryEscape(n.accountSlug)
+	}
+
+	var zones []DnsZone
+	err := n.getJSON(ctx, endpoint, &zones)
+	if errors.Is(err, ErrUnauthorized) {
+		return fmt.Errorf("token invalid or lacks DNS scope: %w", err)
+	}
+	return err
+}
+
+// GetDnsZone fetches a single zone by ID. A zone that does not exist
+// returns an error matching ErrNotFound.
+func (n *NetlifyDnsClient) GetDnsZone(ctx context.Context, zoneId string) (DnsZone, error) {
+	var zone DnsZone
+	err := n.getJSON(ctx, "dns_zones/"+zoneId, &zone)
+	if err != nil {
+		return DnsZone{}, err
+	}
+	return zone, nil
+}
+
+// GetDnsRecord fetches a single record of a zone by ID. A record that does
+// not exist returns an error matching ErrNotFound.
+func (n *NetlifyDnsClient) GetDnsRecord(ctx context.Context, zoneId, recordId string) (DnsRecord, error) {
+	var record DnsRecord
+	err := n.getJSON(ctx, "dns_zones/"+zoneId+"/dns_records/"+recordId, &record)
+	if err != nil {
+		return DnsRecord{}, err
+	}
+	return record, nil
+}
+
+// getJSON fetches a single, unpaginated resource into v
+func (n *NetlifyDnsClient) getJSON(ctx context.Context, endpoint string, v any) error {
+	body, _, err := n.getReqByteSlice(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling get request body: %w", err)
+	}
+	return nil
+}
+
+func (n *NetlifyDnsClient) GetAllDnsRecords(ctx context.Context, zoneId string) ([]DnsRecord, error) {
+	var records []DnsRecord
+	err := n.getAllPages(ctx, "dns_zones/"+zoneId+"/dns_records", func(body []byte) error {
+		var page []DnsRecord
+		err := json.Unmarshal(body, &page)
+		if err != nil {
+			return fmt.Errorf("error unmarshalling get request body: %w", err)
+		}
+
+		records = append(records, page...)
+		if n.maxRecords > 0 && len(records) > n.maxRecords {
+			return fmt.Errorf("zone %s has more than %d records, the most the client fetches", zoneId, n.maxRecords)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// dnsRecordRequest is the body Netlify expects when creating a record
+type dnsRecordRequest struct {
+	Type     string  `json:"type"`
+	Hostname string  `json:"hostname"`
+	Value    string  `json:"value"`
+	Ttl      int     `json:"ttl,omitempty"`
+	Priority *int    `json:"priority,omitempty"`
+	Weight   *int    `json:"weight,omitempty"`
+	Port     *int    `json:"port,omitempty"`
+	Flag     *string `json:"flag,omitempty"`
+	Tag      *string `json:"tag,omitempty"`
+}
+
+// CreateDnsRecord adds record to the zone and returns the record as stored
+// by Netlify. Priority is only sent for MX and SRV records, weight and port
+// for SRV and flag and tag for CAA. It is not retried because it is not
+// idempotent.
+func (n *NetlifyDnsClient) CreateDnsRecord(ctx context.Context, zoneId string, record DnsRecord) (DnsRecord, error) {
+	request := dnsRecordRequest{
+		Type:     record.Type,
+		Hostname: record.Hostname,
+		Value:    record.Value,
+		Ttl:      record.Ttl,
+	}
+	switch record.Type {
+	case "MX":
+		request.Priority = &record.Priority
+	case "SRV":
+		request.Priority = &record.Priority
+		request.Weight = record.Weight
+		request.Port = record.Port
+	case "CAA":
+		request.Flag = record.Flag
+		request.Tag = record.Tag
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return DnsRecord{}, fmt.Errorf("error marshalling post request body: %w", err)
+	}
+
+	body, _, err := n.doOnce(ctx, "POST", "dns_zones/"+zoneId+"/dns_records", payload)
+	if err != nil {
+		return DnsRecord{}, err
+	}
+
+	var created DnsRecord
+	err = json.Unmarshal(body, &created)
+	if err != nil {
+		return DnsRecord{}, fmt.Errorf("error unmarshalling post request body: %w", err)
+	}
+
+	return created, nil
+}
+
+// DeleteDnsRecord removes a record from the zone. Deleting a record that
+// does not exist returns an error matching ErrNotFound, which callers may
+// ignore. It is not retried, as a retry of a deletion that went through
+// but whose response was lost would fail with ErrNotFound.
+func (n *NetlifyDnsClient) DeleteDnsRecord(ctx context.Context, zoneId, recordId string) error {
+	_, _, err := n.doOnce(ctx, "DELETE", "dns_zones/"+zoneId+"/dns_records/"+recordId, nil)
+	return err
+}
+
+// GenerateZoneFile is WriteZoneFile returning the zone file as a string. Like
+// WriteZoneFile it has no side effects besides logging to opts.Logger and
+// calling opts.OnRedirect, so it is safe to call concurrently.
+func GenerateZoneFile(zone DnsZone, records []DnsRecord, redirects []Redirect, opts ZoneOptions) (string, error) {
+	var zoneFile bytes.Buffer
+	err := WriteZoneFile(&zoneFile, zone, records, redirects, opts)
+	if err != nil {
+		return "", err
+	}
+	return zoneFile.String(), nil
+}
+
+// GenerateZoneFiles generates the zone files of several zones, taking the
+// records of each from recordsByZone by zone ID. The zone files and the
+// errors of the zones that failed are returned keyed by zone name, so one
+// zone failing does not keep the others from being generated.
+func GenerateZoneFiles(zones []DnsZone, recordsByZone map[string][]DnsRecord, redirects []Redirect, opts ZoneOptions) (map[string]string, map[string]error) {
+	zoneFiles := make(map[string]string, len(zones))
+	errs := make(map[string]error)
+	for _, zone := range zones {
+		zoneFile, err := GenerateZoneFile(zone, recordsByZone[zone.Id], redirects, opts)
+		if err != nil {
+			errs[zone.Name] = err
+			continue
+		}
+		zoneFiles[zone.Name] = zoneFile
+	}
+	return zoneFiles, errs
+}
+
+// WriteZoneFile writes the zone file of a zone to w. The record lines are
+// formatted up front, since the header and the SOA serial depend on all of
+// them, but the file itself is written out line by line rather than built
+// in memory as a whole.
+func WriteZoneFile(w io.Writer, zone DnsZone, records []DnsRecord, redirects []Redirect, opts ZoneOptions) error {
+	opts = opts.withDefaults()
+	opts.Class = strings.ToUpper(opts.Class)
+	if !recordClasses[opts.Class] {
+		return fmt.Errorf("unknown record class %q, expected IN, CH, HS or CS", opts.Class)
+	}
+	switch opts.LineEnding {
+	case LineEndingLF:
+	case LineEndingCRLF:
+		w = crlfWriter{w}
+	default:
+		return fmt.Errorf("unknown line ending %q, expected %s or %s", opts.LineEnding, LineEndingLF, LineEndingCRLF)
+	}
+	records = opts.overrideTtls(records)
+
+	defaultTtl := opts.DefaultTtl
+	if defaultTtl == 0 {
+		defaultTtl = mostCommonTtl(records, opts.Minimum)
+	}
+
+	unicodeOrigin := strings.TrimSuffix(zone.Name, ".")
+	origin, err := asciiName(zone.Name)
+	if err != nil {
+		return err
+	}
+	zone.Name = origin
+
+	var recordLines []string
+	// Track processed records so only truly identical ones are collapsed,
+	// names may legitimately carry several records of the same type. The
+	// key holds the written data so records differing only in priority,
+	// weight, port, flag or tag are all kept.
+	type recordKey struct {
+		hostname, recordType, data string
+	}
+	processedRecords := make(map[recordKey]bool)
+	// The types written at each name, with or without its trailing dot, to
+	// catch CNAMEs sharing their name
+	nameTypes := make(map[string][]string)
+	// The name and type of each record line, to comment round-robin groups
+	type lineGroup struct {
+		name, recordType string
+	}
+	var lineGroups []lineGroup
+
+	// Remember the Unicode form of converted hostnames for their comments
+	unicodeNames := make(map[string]string)
+	asciiRecords := make([]DnsRecord, len(records))
+	for i, record := range records {
+		record.Hostname, err = asciiName(record.Hostname)
+		if err != nil {
+			return err
+		}
+		unicodeNames[record.Hostname] = records[i].Hostname
+		asciiRecords[i] = record
+	}
+
+	for _, record := range sortRecords(asciiRecords, zone.Name) {
+		if err := validateHostname(record.Hostname); err != nil {
+			if opts.Strict {
+				return validationError{err}
+			}
+			opts.logger().Warn("skipping record with an invalid hostname", "zone", zone.Name, "type", record.Type, "error", err)
+			continue
+		}
+		if record.Type == "SRV" && !hasServiceLabels(record.Hostname) {
+			err := fmt.Errorf("SRV record %s is missing its _service._proto labels", record.Hostname)
+			if opts.Strict {
+				return validationError{err}
+			}
+			opts.logger().Warn("skipping SRV record without service labels", "zone", zone.Name, "hostname", record.Hostname, "error", err)
+			continue
+		}
+
+		if err := validateAddress(record.Type, record.Value); err != nil {
+			if opts.Strict {
+				opts.logger().Warn("skipping record with an invalid address", "zone", zone.Name, "hostname", record.Hostname, "error", err)
+				continue
+			}
+			opts.logger().Warn("invalid address", "zone", zone.Name, "hostname", record.Hostname, "error", err)
+		}
+
+		if err := validateRecordData(record); err != nil {
+			if opts.Strict {
+				opts.logger().Warn("skipping record with invalid data", "zone", zone.Name, "hostname", record.Hostname, "type", record.Type, "error", err)
+				continue
+			}
+			opts.logger().Warn("invalid record data", "zone", zone.Name, "hostname", record.Hostname, "type", record.Type, "error", err)
+		}
+
+		name := relativeName(record.Hostname, zone.Name)
+
+		// Check if this record has been processed
+		key := recordKey{record.Hostname, record.Type, recordData(record, record.Value)}
+		if _, exists := processedRecords[key]; exists {
+			opts.logger().Info("ignoring duplicate record", "zone", zone.Name, "type", record.Type, "hostname", record.Hostname)
+			continue
+		}
+
+		// Now mark this record as processed
+		processedRecords[key] = true
+
+		if opts.OmitApexNS && record.Type == "NS" && name == "@" {
+			continue
+		}
+		if opts.skipApexAlias(zone.Name, record) {
+			continue
+		}
+
+		value := redirectedValue(record, redirects, opts)
+		if holdsName(record.Type) {
+			value, err = asciiName(value)
+			if err != nil {
+				return err
+			}
+		}
+
+		var comments []string
+		if opts.AnnotateNetlify && typeWithReplacement(record.Type) != record.Type {
+			comments = append(comments, fmt.Sprintf("netlify-managed (%s)", record.Type))
+		}
+		if opts.UnicodeComments && unicodeNames[record.Hostname] != record.Hostname {
+			comments = append(comments, unicodeNames[record.Hostname])
+		}
+		if opts.AnnotateIds && record.Id != "" {
+			comments = append(comments, "id="+record.Id)
+		}
+
+		hostname := normalizeZoneName(record.Hostname)
+		nameTypes[hostname] = append(nameTypes[hostname], typeWithReplacement(record.Type))
+		lineGroups = append(lineGroups, lineGroup{name, typeWithReplacement(record.Type)})
+		recordLines = append(recordLines,
+			fmt.Sprintf(
+				"%s\t%s%s\t%s\t%s%s\n",
+				name,
+				opts.Class,
+				ttlColumn(record.Ttl, defaultTtl),
+				typeWithReplacement(record.Type),
+				recordData(record, value),
+				trailingComment(comments),
+			),
+		)
+	}
+
+	for _, err := range cnameConflicts(zone.Name, nameTypes, opts.ApexCNAME) {
+		if opts.Strict {
+			return validationError{err}
+		}
+		opts.logger().Warn("conflicting CNAME record", "zone", zone.Name, "error", err)
+	}
+
+	zoneFile := bufio.NewWriter(w)
+	zoneFile.WriteString(zoneHeader(unicodeOrigin, len(recordLines), opts.GeneratedAt))
+	var originComments []string
+	if opts.UnicodeComments && unicodeOrigin != strings.TrimSuffix(zone.Name, ".") {
+		originComments = append(originComments, unicodeOrigin)
+	}
+	fmt.Fprintf(zoneFile, "$ORIGIN %s%s\n", fqdn(zone.Name), trailingComment(originComments))
+	fmt.Fprintf(zoneFile, "$TTL %d\n", defaultTtl)
+
+	if !opts.OmitSOA {
+		serial := opts.Serial
+		if serial == 0 {
+			serial, err = zoneSerial(opts.SerialStrategy, recordLines, opts.GeneratedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(
+			zoneFile,
+			"@\t%s%s\tSOA\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+			opts.Class,
+			ttlColumn(opts.Minimum, defaultTtl),
+			fqdn(opts.PrimaryNameserver),
+			soaMailbox(opts.AdminEmail),
+			serial,
+			opts.Refresh,
+			opts.Retry,
+			opts.Expire,
+			opts.Minimum,
+		)
+	}
+
+	// Sorting keeps the records of a name and type together, and several
+	// addresses for one name are served round-robin
+	groupSizes := make(map[lineGroup]int)
+	for _, group := range lineGroups {
+		groupSizes[group]++
+	}
+	for i, line := range recordLines {
+		group := lineGroups[i]
+		if (group.recordType == "A" || group.recordType == "AAAA") && groupSizes[group] > 1 && (i == 0 || lineGroups[i-1] != group) {
+			fmt.Fprintf(zoneFile, "; %d %s records (round-robin)\n", groupSizes[group], group.recordType)
+		}
+		zoneFile.WriteString(line)
+	}
+
+	// bufio.Writer keeps the first write error, which Flush returns
+	return zoneFile.Flush()
+}
+
+// crlfWriter converts the LF line endings written to it to CRLF
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+	_, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n")))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// zoneHeader returns the comment block opening a zone file
+func zoneHeader(zoneName string, recordCount int, generatedAt time.Time) string {
+	generated := "; Generated by netlify-dns-zone-file " + Version
+	if !generatedAt.IsZero() {
+		generated += " at " + generatedAt.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf(";\n; Zone %s exported from Netlify, %d record(s)\n%s\n;\n", zoneName, recordCount, generated)
+}
+
+// asciiName converts an internationalized domain name to the punycode form
+// zone files need, leaving ASCII names unchanged
+func asciiName(name string) (string, error) {
+	ascii, err := idna.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid domain name %s: %w", name, err)
+	}
+	return ascii, nil
+}
+
+// trailingComment returns the comment ending a line with the given notes,
+// if any. Everything after the semicolon is ignored by zone file parsers.
+func trailingComment(notes []string) string {
+	if len(notes) == 0 {
+		return ""
+	}
+	return "\t; " + strings.Join(notes, ", ")
+}
+
+// holdsName reports whether the value of a record type is a domain name
+func holdsName(recordType string) bool {
+	switch recordType {
+	case "CNAME", "NETLIFY", "NETLIFYv6", "NS", "PTR", "MX", "SRV":
+		return true
+	}
+	return false
+}
+
+// sortRecords returns a copy of records in the order they are written: apex
+// NS records first, then the other apex records, then everything else, each
+// group sorted by hostname, type and value so output is stable across runs
+func sortRecords(records []DnsRecord, zoneName string) []DnsRecord {
+	sorted := append([]DnsRecord(nil), records...)
+	origin := normalizeZoneName(zoneName)
+
+	rank := func(record DnsRecord) int {
+		if normalizeZoneName(record.Hostname) != origin {
+			return 2
+		}
+		if record.Type == "NS" {
+			return 0
+		}
+		return 1
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if rank(a) != rank(b) {
+			return rank(a) < rank(b)
+		}
+		if hostA, hostB := normalizeZoneName(a.Hostname), normalizeZoneName(b.Hostname); hostA != hostB {
+			return hostA < hostB
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if a.Value != b.Value {
+			return a.Value < b.Value
+		}
+		return a.Ttl < b.Ttl
+	})
+
+	return sorted
+}
+
+// relativeName returns hostname relative to the zone's $ORIGIN: @ for the
+// apex, the leading labels for names inside the zone and the fully
+// qualified name for anything else
+func relativeName(hostname, zoneName string) string {
+	host := normalizeZoneName(hostname)
+	origin := normalizeZoneName(zoneName)
+
+	switch {
+	case host == origin:
+		return "@"
+	case strings.HasSuffix(host, "."+origin):
+		return host[:len(host)-len(origin)-1]
+	default:
+		return fqdn(host)
+	}
+}
+
+// fqdn returns name with exactly one trailing dot, whether or not Netlify
+// stored it with one
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+// mostCommonTtl returns the TTL shared by the most records, preferring the
+// lower value on a tie, or fallback when no record has a TTL
+func mostCommonTtl(records []DnsRecord, fallback int) int {
+	counts := make(map[int]int)
+	for _, record := range records {
+		if record.Ttl != 0 {
+			counts[record.Ttl]++
+		}
+	}
+
+	ttl, best := fallback, 0
+	for candidate, count := range counts {
+		if count > best || (count == best && candidate < ttl) {
+			ttl, best = candidate, count
+		}
+	}
+	return ttl
+}
+
+// ttlColumn returns the tab-prefixed TTL column of a line, or nothing when
+// the TTL is unset or matches the zone's $TTL default
+func ttlColumn(ttl, defaultTtl int) string {
+	if ttl == 0 || ttl == defaultTtl {
+		return ""
+	}
+	return fmt.Sprintf("\t%d", ttl)
+}
+
+// recordData formats everything after the type column of a record's line
+func recordData(record DnsRecord, value string) string {
+	switch record.Type {
+	case "CNAME", "NETLIFY", "NETLIFYv6", "PTR", "NS":
+		return fqdn(value)
+	case "MX":
+		// The preference always precedes the exchange, even when it is 0
+		return fmt.Sprintf("%d\t%s", record.Priority, fqdn(value))
+	case "SRV":
+		return fmt.Sprintf("%d\t%d\t%d\t%s", record.Priority, intOrZero(record.Weight), intOrZero(record.Port), fqdn(value))
+	case "TXT", "SPF":
+		return quoteTxt(value)
+	case "DS", "TLSA":
+		// Three numeric fields, the key tag, algorithm and digest type of DS
+		// records or the usage, selector and matching type of TLSA records,
+		// then hex data that is sometimes split into several chunks
+		fields := strings.Fields(value)
+		if len(fields) > 4 {
+			fields = append(fields[:3], strings.Join(fields[3:], ""))
+		}
+		return strings.Join(fields, "\t")
+	case "CAA":
+		flag := "0"
+		if record.Flag != nil && *record.Flag != "" {
+			flag = *record.Flag
+		}
+		tag := "issue"
+		if record.Tag != nil && *record.Tag != "" {
+			tag = *record.Tag
+		}
+		return fmt.Sprintf("%s\t%s\t%s", flag, tag, quoteString(strings.Trim(value, `"`)))
+	default:
+		// Only MX and SRV records have a priority, one Netlify reports for
+		// other types is not part of their data
+		return value
+	}
+}
+
+// quoteString wraps s in double quotes, escaping backslashes and quotes,
+// and control characters as \DDD decimal escapes so the string stays on
+// one line
+func quoteString(s string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' || c == '"':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&quoted, "\\%03d", c)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+// maxTxtChunkLen is the longest character-string a TXT record can hold
+const maxTxtChunkLen = 255
+
+// quoteTxt quotes a TXT value, splitting it into several quoted strings
+// when it is longer than a single character-string allows. A value that
+// already is a list of quoted strings, as Netlify returns some DKIM keys,
+// keeps its strings.
+func quoteTxt(value string) string {
+	texts, ok := splitQuotedStrings(value)
+	if !ok {
+		texts = []string{value}
+	}
+
+	var chunks []string
+	for _, text := range texts {
+		for len(text) > maxTxtChunkLen {
+			chunks = append(chunks, quoteString(text[:maxTxtChunkLen]))
+			text = text[maxTxtChunkLen:]
+		}
+		chunks = append(chunks, quoteString(text))
+	}
+
+	return strings.Join(chunks, " ")
+}
+
+// splitQuotedStrings returns the unquoted strings of a value made only of
+// whitespace separated quoted strings, and false for any other value
+func splitQuotedStrings(value string) ([]string, bool) {
+	var texts []string
+	rest := strings.TrimSpace(value)
+	for rest != "" {
+		if rest[0] != '"' {
+			return nil, false
+		}
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return nil, false
+		}
+
+		text, err := unquoteString(rest[:end+1])
+		if err != nil {
+			return nil, false
+		}
+		texts = append(texts, text)
+
+		rest = rest[end+1:]
+		trimmed := strings.TrimLeft(rest, " \t")
+		if trimmed != "" && len(trimmed) == len(rest) {
+			return nil, false
+		}
+		rest = trimmed
+	}
+	return texts, len(texts) > 0
+}
+
+func intOrZero(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// hasServiceLabels reports whether hostname starts with the _service._proto
+// labels an SRV record name requires
+func hasServiceLabels(hostname string) bool {
+	labels := strings.Split(hostname, ".")
+	return len(labels) > 2 && len(labels[0]) > 1 && len(labels[1]) > 1 &&
+		strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_")
+}
+
+// skipApexAlias reports whether record is a NETLIFY or NETLIFYv6 record at
+// the apex of the zone, logging that it is left out. Such records would be
+// written as a CNAME, which is not allowed next to the SOA and NS records of
+// the apex, unless they are flattened first or o.ApexCNAME keeps them.
+func (o ZoneOptions) skipApexAlias(zoneName string, record DnsRecord) bool {
+	if o.ApexCNAME || typeWithReplacement(record.Type) == record.Type || normalizeZoneName(record.Hostname) != normalizeZoneName(zoneName) {
+		return false
+	}
+	o.logger().Warn("skipping apex record, a CNAME is not allowed at the zone apex, use -flatten-alias to write its addresses instead",
+		"zone", zoneName, "type", record.Type, "target", record.Value)
+	return true
+}
+
+func typeWithReplacement(recordType string) string {
+	if recordType == "NETLIFY" || recordType == "NETLIFYv6" {
+		return "CNAME"
+	}
+	return recordType
+}
+
+// writeZoneBlock writes a zone's contents to w, preceded by a comment naming
+// the zone unless commentPrefix is empty
+func writeZoneBlock(w io.Writer, zone DnsZone, zoneContents string, commentPrefix string) error {
+	if commentPrefix != "" {
+		_, err := fmt.Fprintf(w, "%s zone: %s\n", commentPrefix, zone.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, zoneContents)
+	return err
+}
+
+// zoneFileBaseName returns the name, without extension, of the file a zone is
+// written to. naming is either "name" for the sanitized domain or "id" for
+// the Netlify zone ID. Names that could escape the output directory are
+// rejected.
+func zoneFileBaseName(zone DnsZone, naming string) (string, error) {
+	var name string
+	switch naming {
+	case "id":
+		name = zone.Id
+	case "name":
+		name = sanitizeFileName(zone.Name)
+	default:
+		return "", fmt.Errorf("unknown file naming %q, expected name or id", naming)
+	}
+
+	if name == "" || strings.Contains(name, "..") || strings.ContainsAny(name, "/\\\x00") {
+		return "", fmt.Errorf("zone %q cannot be written to a file named %q safely", zone.Name, name)
+	}
+	return name, nil
+}
+
+// sanitizeFileName replaces every character that is not safe in a file
+// name on common platforms with an underscore
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// resolveToken picks the Netlify token from, in order of precedence, the
+// -token flag, the file named by -token-file and the NETLIFY_TOKEN variable,
+// falling back to the Netlify CLI's token when useCLIAuth is set
+func resolveToken(flagToken, tokenFile string, useCLIAuth bool, getenv func(string) string) (string, error) {
+	if flagToken != "" {
+		return flagToken, nil
+	}
+
+	if tokenFile != "" {
+		content, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading token file: %w", err)
+		}
+
+		token := strings.TrimRightFunc(string(content), unicode.IsSpace)
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", tokenFile)
+		}
+		return token, nil
+	}
+
+	if token := getenv("NETLIFY_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	if useCLIAuth {
+		return netlifyCLIToken(getenv)
+	}
+
+	return "", errors.New("no Netlify token set, use -token, -token-file, NETLIFY_TOKEN or -use-cli-auth")
+}
+
+// prepareOutputDir creates dir if it is missing and makes sure it is a directory
+func prepareOutputDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("output path %s exists and is not a directory", dir)
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error checking output directory: %w", err)
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to path with mode 0644 through a .tmp file
+// renamed into place, so a DNS server never loads a truncated zone file
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// gzipped compresses data with gzip, leaving the name and modification
+// time out of the header so the output only changes with data
+func gzipped(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write(data)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error compressing output: %w", err)
+	}
+	return compressed.Bytes(), nil
+}
+
+// readOutputFile returns the contents of an output file written earlier,
+// decompressing it when compressed
+func readOutputFile(path string, compressed bool) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !compressed {
+		return string(data), err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	data, err = io.ReadAll(reader)
+	return string(data), err
+}
+
+// withoutGenerationTime drops the generation time from the headers of zone
+// files and the serial from their SOA records, which is derived from that
+// time, so output that only differs in when it was generated compares equal
+func withoutGenerationTime(contents string) string {
+	lines := strings.Split(contents, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "; Generated by netlify-dns-zone-file ") {
+			lines[i], _, _ = strings.Cut(line, " at ")
+		}
+	}
+	for _, at := range soaSerials(lines) {
+		fields := strings.Split(lines[at.line], "\t")
+		fields[at.field] = ""
+		lines[at.line] = strings.Join(fields, "\t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// soaSerial locates the serial of an SOA record in a zone file, as the
+// index of its line and of its tab separated field
+type soaSerial struct{ line, field int }
+
+// soaSerials returns the SOA serials of zone file lines, as written by
+// GenerateZoneFile, in the order they appear
+func soaSerials(lines []string) []soaSerial {
+	var serials []soaSerial
+	for i, line := range lines {
+		fields := strings.Split(line, "\t")
+		for j, field := range fields {
+			if field == "SOA" && j+3 < len(fields) {
+				serials = append(serials, soaSerial{i, j + 3})
+				break
+			}
+		}
+	}
+	return serials
+}
+
+// increasingSerials returns contents with each SOA serial that is not above
+// that of the matching SOA record in previous, the file it replaces, set to
+// one more than it, so secondaries never see a zone go back in time
+func increasingSerials(previous, contents string) string {
+	previousLines := strings.Split(previous, "\n")
+	lines := strings.Split(contents, "\n")
+	previousSerials := soaSerials(previousLines)
+	for n, at := range soaSerials(lines) {
+		if n == len(previousSerials) {
+			break
+		}
+		last, err := strconv.ParseUint(strings.Split(previousLines[previousSerials[n].line], "\t")[previousSerials[n].field], 10, 32)
+		if err != nil || last == math.MaxUint32 {
+			continue
+		}
+		fields := strings.Split(lines[at.line], "\t")
+		serial, err := strconv.ParseUint(fields[at.field], 10, 32)
+		if err == nil && serial <= last {
+			fields[at.field] = strconv.FormatUint(last+1, 10)
+			lines[at.line] = strings.Join(fields, "\t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// errZonesDiffer is returned by Run in -diff mode when the zones differ,
+// after the differences have been printed
+var errZonesDiffer = errors.New("zone files differ")
+
+// RunEnv is what Run needs from the process, so the command can also be
+// driven with buffers and a fake Netlify API. Unset fields default to the
+// standard streams and environment of the process and NewNetlifyClient.
+type RunEnv struct {
+	// Context is cancelled when the command is interrupted, nil meaning it
+	// never is
+	Context        context.Context
+	Stdout, Stderr io.Writer
+	Getenv         func(string) string
+	// NewClient builds the client the zones are read from and applied to
+	NewClient func(token string, opts ...ClientOption) ZoneApplier
+}
+
+func (e RunEnv) withDefaults() RunEnv {
+	if e.Stdout == nil {
+		e.Stdout = os.Stdout
+	}
+	if e.Stderr == nil {
+		e.Stderr = os.Stderr
+	}
+	if e.Getenv == nil {
+		e.Getenv = os.Getenv
+	}
+	if e.NewClient == nil {
+		e.NewClient = NewNetlifyClient
+	}
+	return e
+}
+
+// tokenChecker is implemented by clients that can check their token before
+// any real work is done, as NetlifyDnsClient does
+type tokenChecker interface {
+	CheckToken(ctx context.Context) error
+}
+
+// NewNetlifyClient is the RunEnv.NewClient talking to the Netlify API
+func NewNetlifyClient(token string, opts ...ClientOption) ZoneApplier {
+	client := NewNetlifyDnsClient(token, opts...)
+	return &client
+}
+
+// Run is the command line tool, doing what opts ask with the process
+// resources in env
+func Run(opts Options, env RunEnv) (err error) {
+	started := time.Now()
+	opts = opts.withDefaults()
+	env = env.withDefaults()
+
+	if opts.ShowVersion {
+		_, err := fmt.Fprintln(env.Stdout, versionString())
+		return err
+	}
+
+	if opts.Verbose && opts.Quiet {
+		return usageError{errors.New("-v and -q cannot be used together")}
+	}
+	if opts.Account != "" && !validAccountSlug(opts.Account) {
+		return usageError{fmt.Errorf("-account %q is not a Netlify team slug, which is made of lowercase letters, digits and hyphens", opts.Account)}
+	}
+	if opts.LineEnding != LineEndingLF && opts.LineEnding != LineEndingCRLF {
+		return usageError{fmt.Errorf("-line-ending must be %s or %s, got %q", LineEndingLF, LineEndingCRLF, opts.LineEnding)}
+	}
+	if opts.Class != "" && !recordClasses[strings.ToUpper(opts.Class)] {
+		return usageError{fmt.Errorf("-class must be IN, CH, HS or CS, got %q", opts.Class)}
+	}
+	if _, err := newTypeFilter(opts.IncludeTypes, opts.ExcludeTypes); err != nil {
+		return usageError{err}
+	}
+	if opts.Ttl < 0 {
+		return usageError{fmt.Errorf("-ttl must be a positive number of seconds, got %d", opts.Ttl)}
+	}
+	typeTtls, err := canonicalTypeTtls(opts.TypeTtls)
+	if err != nil {
+		return usageError{err}
+	}
+	logger := NewLogger(env.Stderr, opts.Verbose, opts.Quiet)
+
+	if opts.FileNaming != "name" && opts.FileNaming != "id" {
+		return usageError{fmt.Errorf("unknown file naming %q, expected name or id", opts.FileNaming)}
+	}
+
+	format, err := lookupFormat(opts.Format)
+	if err != nil {
+		return usageError{err}
+	}
+
+	if opts.Offline && opts.CacheDir == "" {
+		return usageError{errors.New("-offline regenerates zone files from the -cache directory, which is not set")}
+	}
+	if !opts.Since.IsZero() && opts.CacheDir == "" {
+		return usageError{errors.New("-since leaves the files of unchanged zones as they are and needs -cache to keep their records")}
+	}
+	if !opts.Since.IsZero() && (opts.Stdout || opts.SingleFile != "" || opts.DiffPath != "") {
+		return usageError{errors.New("-since only writes changed zones and cannot be used with -stdout, -single-file or -diff")}
+	}
+	if opts.Gzip && (opts.Stdout || opts.DiffPath != "") {
+		return usageError{errors.New("-gzip compresses output files and cannot be used with -stdout or -diff")}
+	}
+	if opts.Offline && opts.ApplyPath != "" {
+		return usageError{errors.New("-apply changes Netlify and cannot be used with -offline")}
+	}
+
+	// Offline runs never talk to Netlify, so they need no token
+	token := ""
+	if !opts.Offline {
+		token, err = resolveToken(opts.Token, opts.TokenFile, opts.UseCLIAuth, env.Getenv)
+		if err != nil {
+			return usageError{err}
+		}
+	}
+
+	if opts.SingleFile != "" && !format.zoneFile {
+		return usageError{fmt.Errorf("-single-file combines zone files and cannot be used with -format %s", opts.Format)}
+	}
+
+	if opts.DiffPath != "" && !format.zoneFile {
+		return usageError{fmt.Errorf("-diff compares zone files and cannot be used with -format %s", opts.Format)}
+	}
+
+	if opts.Check && !format.zoneFile {
+		return usageError{fmt.Errorf("-check validates zone files and cannot be used with -format %s", opts.Format)}
+	}
+
+	client := env.NewClient(token,
+		WithBaseURL(opts.APIURL),
+		WithRetries(opts.Retries, defaultRetryBaseDelay),
+		WithTimeout(opts.Timeout),
+		WithLogger(logger),
+		WithAccountSlug(opts.Account),
+		WithMaxRecords(opts.MaxRecords),
+	)
+
+	// Each request is bounded by -timeout, a whole run is only bounded by
+	// the caller, as large accounts can take longer than any fixed limit
+	ctx := env.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if checker, ok := client.(tokenChecker); ok && !opts.Offline {
+		err := checker.CheckToken(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.ApplyPath != "" {
+		return applyZoneFile(ctx, client, opts.ApplyPath, applyOptions{
+			DryRun:          opts.DryRun,
+			Confirm:         opts.Confirm,
+			DeleteThreshold: opts.DeleteThreshold,
+		}, env.Stdout)
+	}
+
+	if !opts.Stdout && !opts.DryRun && opts.DiffPath == "" && opts.SingleFile == "" {
+		err := prepareOutputDir(opts.OutDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Netlify evaluates _redirects before the rules in netlify.toml
+	redirectsPath := opts.RedirectsPath
+	if redirectsPath == "" {
+		redirectsPath = "_redirects"
+	}
+	redirects, warnings, err := loadRedirectsFile(redirectsPath, opts.RedirectsPath != "")
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		logger.Warn(warning, "file", redirectsPath)
+	}
+
+	tomlPaths := opts.TomlPaths
+	if len(tomlPaths) == 0 {
+		tomlPaths = []string{"netlify.toml"}
+	}
+	var tomlRedirects [][]Redirect
+	for _, tomlPath := range tomlPaths {
+		fileRedirects, warnings, err := loadRedirects(tomlPath, len(opts.TomlPaths) > 0)
+		if err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			logger.Warn(warning, "file", tomlPath)
+		}
+		tomlRedirects = append(tomlRedirects, fileRedirects)
+	}
+	redirects = append(redirects, mergeRedirects(tomlRedirects)...)
+
+	zoneOpts := ZoneOptions{
+		UnicodeComments: opts.UnicodeComments,
+		AnnotateNetlify: opts.AnnotateNetlify,
+		AnnotateIds:     opts.AnnotateIds,
+		Ttl:             opts.Ttl,
+		TypeTtls:        typeTtls,
+		Strict:          opts.Strict,
+		LineEnding:      opts.LineEnding,
+		Class:           opts.Class,
+		Logger:          logger,
+	}
+	if !opts.NoTimestamp {
+		zoneOpts.GeneratedAt = time.Now()
+	}
+
+	var fetcher ZoneFetcher = client
+	if opts.CacheDir != "" {
+		var live ZoneFetcher
+		if !opts.Offline {
+			live = client
+		}
+		fetcher, err = newCachedFetcher(live, opts.CacheDir, logger)
+		if err != nil {
+			return err
+		}
+	}
+
+	var onProgress func(ExportProgress)
+	if opts.Progress && !opts.Quiet {
+		onProgress = func(progress ExportProgress) {
+			status := fmt.Sprintf("%d records", progress.Records)
+			if progress.Err != nil {
+				status = "failed"
+			}
+			fmt.Fprintf(env.Stderr, "[%d/%d] %s: %s\n", progress.Done, progress.Total, progress.Zone.Name, status)
+		}
+	}
+
+	// The metrics describe the export and are written however it ends
+	var exported []exportedZone
+	if opts.MetricsPath != "" {
+		defer func() {
+			metrics := exportMetrics{Zones: len(exported), Duration: time.Since(started), LastSuccess: lastSuccess(opts.MetricsPath)}
+			for _, result := range exported {
+				metrics.Records += len(result.records)
+			}
+			if err == nil {
+				metrics.LastSuccess = time.Now()
+			}
+
+			metricsErr := writeMetrics(opts.MetricsPath, metrics)
+			if err == nil {
+				err = metricsErr
+			} else if metricsErr != nil {
+				logger.Error(metricsErr.Error())
+			}
+		}()
+	}
+
+	exported, exportErr := exportZones(ctx, fetcher, ExportOptions{
+		Zones:            opts.Zones,
+		IncludeTypes:     opts.IncludeTypes,
+		ExcludeTypes:     opts.ExcludeTypes,
+		HostnameMatch:    opts.Match,
+		HostnameNotMatch: opts.NotMatch,
+		Redirects:        redirects,
+		ZoneOptions:      zoneOpts,
+		Concurrency:      opts.Concurrency,
+		Format:           opts.Format,
+		FailFast:         opts.FailFast,
+		SkipManaged:      opts.SkipManaged,
+		FailOnEmpty:      opts.FailOnEmpty,
+		FlattenAliases:   opts.FlattenAliases,
+		OnProgress:       onProgress,
+		ChangedSince:     opts.Since,
+	})
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted before any zone file was written: %w", ctx.Err())
+	}
+	if exportErr != nil && len(exported) == 0 {
+		return exportErr
+	}
+
+	if opts.DiffPath != "" {
+		if exportErr != nil {
+			return exportErr
+		}
+		if len(exported) != 1 {
+			return fmt.Errorf("-diff needs exactly one zone but %d were exported, select one with -zone", len(exported))
+		}
+
+		local, err := os.ReadFile(opts.DiffPath)
+		if err != nil {
+			return err
+		}
+
+		differences := diffZoneFiles(string(local), exported[0].contents)
+		if len(differences) == 0 {
+			return nil
+		}
+
+		fmt.Fprintf(env.Stdout, "--- %s\n+++ %s (live)\n", opts.DiffPath, exported[0].zone.Name)
+		for _, line := range differences {
+			fmt.Fprintln(env.Stdout, line)
+		}
+		return errZonesDiffer
+	}
+
+	// writeOutput writes an output file, compressed with -gzip, unless the
+	// file already holds the same output apart from its generation time,
+	// reporting whether it was written. Serials are kept above those of the
+	// file it replaces.
+	writeOutput := func(path, contents string) (bool, error) {
+		existing, err := readOutputFile(path, opts.Gzip)
+		if err == nil {
+			if withoutGenerationTime(existing) == withoutGenerationTime(contents) {
+				logger.Info("unchanged", "file", path)
+				return false, nil
+			}
+			contents = increasingSerials(existing, contents)
+		}
+
+		data := []byte(contents)
+		if opts.Gzip {
+			data, err = gzipped(data)
+			if err != nil {
+				return false, err
+			}
+		}
+		return true, writeFileAtomic(path, data)
+	}
+
+	// -check is best effort, zone files are still written without BIND
+	checkzonePath := ""
+	if opts.Check {
+		path, lookErr := exec.LookPath(namedCheckzone)
+		if lookErr != nil {
+			logger.Warn(namedCheckzone+" not found, skipping -check", "error", lookErr)
+		}
+		checkzonePath = path
+	}
+
+	// validateZone reports the validation problems of a zone file, which
+	// are only an error with -strict, and those named-checkzone finds with
+	// -check
+	validateZone := func(result exportedZone) error {
+		zone, zoneContents := result.zone, result.contents
+		if !format.zoneFile {
+			return nil
+		}
+
+		if checkzonePath != "" {
+			// named-checkzone rejects zones without an SOA record, so
+			// zone files leaving it out are checked in their bind form
+			checked := zoneContents
+			if format.omitsSOA {
+				checkOpts := zoneOpts
+				checkOpts.Logger = nil
+				var err error
+				checked, err = GenerateZoneFile(zone, result.records, redirects, checkOpts)
+				if err != nil {
+					return err
+				}
+			}
+
+			report, err := checkZoneFile(ctx, checkzonePath, zone.Name, checked)
+			if err != nil {
+				return validationError{err}
+			}
+			logger.Info(namedCheckzone+" passed", "zone", zone.Name, "output", report)
+		}
+
+		problems, err := ValidateZoneFile(zoneContents)
+		if err != nil {
+			return err
+		}
+		for _, problem := range problems {
+			logger.Warn(problem.Message, "zone", zone.Name, "line", problem.Line)
+		}
+		if opts.Strict && len(problems) > 0 {
+			return validationError{fmt.Errorf("%s: refusing to write a zone file with %d validation error(s)", zone.Name, len(problems))}
+		}
+		return nil
+	}
+
+	if opts.SingleFile != "" {
+		newline := "\n"
+		if opts.LineEnding == LineEndingCRLF {
+			newline = "\r\n"
+		}
+
+		var combined strings.Builder
+		errs := []error{exportErr}
+		for _, result := range exported {
+			if err := validateZone(result); err != nil {
+				if opts.FailFast {
+					return err
+				}
+				errs = append(errs, err)
+				continue
+			}
+
+			if combined.Len() > 0 {
+				combined.WriteString(newline)
+			}
+			combined.WriteString(result.contents)
+		}
+
+		contents := combined.String()
+		if opts.DryRun {
+			logger.Info("would write zone file", "file", opts.SingleFile, "bytes", len(contents), "lines", strings.Count(contents, "\n"))
+			logSummary(logger, exported)
+			return errors.Join(errs...)
+		}
+
+		written, err := writeOutput(opts.SingleFile, contents)
+		if err != nil {
+			return err
+		}
+		if written {
+			fmt.Fprintln(env.Stdout, opts.SingleFile)
+		}
+		logSummary(logger, exported)
+		return errors.Join(errs...)
+	}
+
+	// Each zone is written on its own, so one failing does not lose the
+	// others unless -fail-fast is set
+	writeZone := func(i int, result exportedZone) error {
+		zone, zoneContents := result.zone, result.contents
+
+		if err := validateZone(result); err != nil {
+			return err
+		}
+
+		baseName, err := zoneFileBaseName(zone, opts.FileNaming)
+		if err != nil {
+			return err
+		}
+		fileName := filepath.Join(opts.OutDir, baseName+format.extension)
+		if opts.Gzip {
+			fileName += ".gz"
+		}
+
+		if opts.DryRun {
+			logger.Info("would write zone file", "file", fileName, "bytes", len(zoneContents), "lines", strings.Count(zoneContents, "\n"))
+		}
+
+		if opts.Stdout {
+			if i > 0 {
+				fmt.Fprintln(env.Stdout)
+			}
+
+			commentPrefix := ""
+			if len(exported) > 1 {
+				commentPrefix = format.commentPrefix
+			}
+
+			return writeZoneBlock(env.Stdout, zone, zoneContents, commentPrefix)
+		}
+
+		if opts.DryRun {
+			return nil
+		}
+
+		written, err := writeOutput(fileName, zoneContents)
+		if err != nil {
+			return err
+		}
+
+		if written {
+			fmt.Fprintln(env.Stdout, fileName)
+		}
+		return nil
+	}
+
+	errs := []error{exportErr}
+	for i, result := range exported {
+		if ctx.Err() != nil {
+			return fmt.Errorf("interrupted after writing %d of %d zone(s): %w", i, len(exported), ctx.Err())
+		}
+
+		err := writeZone(i, result)
+		if err != nil && opts.FailFast {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	logSummary(logger, exported)
+	return errors.Join(errs...)
+}
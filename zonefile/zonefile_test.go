@@ -0,0 +1,2567 @@
+package zonefile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func intPtr(i int) *int { return &i }
+
+func stringPtr(s string) *string { return &s }
+
+// recordLines returns the record lines of a generated zone file, leaving out
+// comments, directives and the SOA record
+func recordLines(t *testing.T, zoneFile string) []string {
+	t.Helper()
+	var lines []string
+	for _, line := range strings.Split(zoneFile, "\n") {
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "$") || strings.Contains(line, "\tSOA\t") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestWriteZoneFileKeepsRecordsDifferingInData(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1", Ttl: 300},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.2", Ttl: 300},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.2", Ttl: 300},
+		{Hostname: "example.com", Type: "CAA", Value: "letsencrypt.org", Flag: stringPtr("0"), Tag: stringPtr("issue"), Ttl: 300},
+		{Hostname: "example.com", Type: "CAA", Value: "letsencrypt.org", Flag: stringPtr("0"), Tag: stringPtr("issuewild"), Ttl: 300},
+		{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 300},
+		{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 20, Ttl: 300},
+		{Hostname: "_sip._tcp.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(5), Port: intPtr(5060), Ttl: 300},
+		{Hostname: "_sip._tcp.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(5), Port: intPtr(5061), Ttl: 300},
+		{Hostname: "_sip._tcp.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(10), Port: intPtr(5061), Ttl: 300},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"@\tIN\tCAA\t0\tissue\t\"letsencrypt.org\"",
+		"@\tIN\tCAA\t0\tissuewild\t\"letsencrypt.org\"",
+		"@\tIN\tMX\t10\tmail.example.com.",
+		"@\tIN\tMX\t20\tmail.example.com.",
+		"_sip._tcp\tIN\tSRV\t10\t5\t5060\tsip.example.com.",
+		"_sip._tcp\tIN\tSRV\t10\t5\t5061\tsip.example.com.",
+		"_sip._tcp\tIN\tSRV\t10\t10\t5061\tsip.example.com.",
+		"www\tIN\tA\t192.0.2.1",
+		"www\tIN\tA\t192.0.2.2",
+	}
+	got := recordLines(t, zoneFile)
+	if len(got) != len(want) {
+		t.Fatalf("got %d record lines, want %d:\n%s", len(got), len(want), zoneFile)
+	}
+	for _, line := range want {
+		if !strings.Contains(zoneFile, line+"\n") {
+			t.Errorf("zone file is missing %q:\n%s", line, zoneFile)
+		}
+	}
+}
+
+func TestGenerateZoneFileWritesNamesRelativeToTheOrigin(t *testing.T) {
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 300},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.2", Ttl: 300},
+		{Hostname: "www.staging.example.com", Type: "A", Value: "192.0.2.3", Ttl: 300},
+	}
+
+	zoneFile, err := GenerateZoneFile(DnsZone{Name: "example.com"}, records, nil, ZoneOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"$ORIGIN example.com.\n", "@\tIN\tA\t192.0.2.1\n", "www\tIN\tA\t192.0.2.2\n", "www.staging\tIN\tA\t192.0.2.3\n"} {
+		if !strings.Contains(zoneFile, line) {
+			t.Errorf("zone file is missing %q:\n%s", line, zoneFile)
+		}
+	}
+
+	problems, err := ValidateZoneFile(zoneFile)
+	if err != nil || len(problems) != 0 {
+		t.Errorf("ValidateZoneFile() = %v, %v, want no problems", problems, err)
+	}
+}
+
+func TestOverrideTtls(t *testing.T) {
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+		{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 3600},
+		{Hostname: "www.example.com", Type: "NETLIFYv6", Value: "example.netlify.app", Ttl: 3600},
+		{Hostname: "old.example.com", Type: "A", Value: "192.0.2.2"},
+	}
+	typeTtls, err := canonicalTypeTtls(map[string]int{"mx": 300, "netlifyv6": 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts ZoneOptions
+		want []int
+	}{
+		{"none", ZoneOptions{}, []int{3600, 3600, 3600, 0}},
+		{"global", ZoneOptions{Ttl: 120}, []int{120, 120, 120, 0}},
+		{"per type", ZoneOptions{TypeTtls: typeTtls}, []int{3600, 300, 60, 0}},
+		{"per type over global", ZoneOptions{Ttl: 120, TypeTtls: typeTtls}, []int{120, 300, 60, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			overridden := test.opts.overrideTtls(records)
+			for i, record := range overridden {
+				if record.Ttl != test.want[i] {
+					t.Errorf("%s %s: got TTL %d, want %d", record.Hostname, record.Type, record.Ttl, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCanonicalTypeTtlsRejectsUnknownTypes(t *testing.T) {
+	if _, err := canonicalTypeTtls(map[string]int{"BOGUS": 60}); err == nil {
+		t.Error("expected an error for an unknown record type")
+	}
+}
+
+func TestGenerateZoneFileSkipsSrvRecordsWithoutServiceLabels(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "_sip._tcp.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(5), Port: intPtr(5060), Ttl: 300},
+		{Hostname: "sip.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(5), Port: intPtr(5060), Ttl: 300},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := recordLines(t, zoneFile)
+	want := "_sip._tcp\tIN\tSRV\t10\t5\t5060\tsip.example.com."
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("got record lines %q, want only %q", got, want)
+	}
+
+	_, err = GenerateZoneFile(zone, records, nil, ZoneOptions{Strict: true})
+	var invalid validationError
+	if !errors.As(err, &invalid) {
+		t.Errorf("got error %v with Strict, want a validation error", err)
+	}
+}
+
+func TestZoneSerial(t *testing.T) {
+	generatedAt := time.Date(2026, time.October, 14, 23, 30, 0, 0, time.UTC)
+	lines := []string{"www\tIN\tA\t192.0.2.1\n", "@\tIN\tMX\t10\tmail.example.com.\n"}
+	changed := []string{"www\tIN\tA\t192.0.2.2\n", "@\tIN\tMX\t10\tmail.example.com.\n"}
+
+	serial, err := zoneSerial(SerialDate, lines, generatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial != 2026101401 {
+		t.Errorf("got date serial %d, want 2026101401", serial)
+	}
+	if again, _ := zoneSerial(SerialDate, changed, generatedAt); again != serial {
+		t.Errorf("got date serial %d for changed records, want %d on the same day", again, serial)
+	}
+
+	hash, _ := zoneSerial(SerialContentHash, lines, time.Time{})
+	reordered, _ := zoneSerial(SerialContentHash, []string{lines[1], lines[0]}, time.Time{})
+	if hash != reordered {
+		t.Errorf("got content hash serials %d and %d for the same records", hash, reordered)
+	}
+	if changedHash, _ := zoneSerial(SerialContentHash, changed, time.Time{}); changedHash == hash {
+		t.Errorf("got content hash serial %d for changed records, want it to change", changedHash)
+	}
+}
+
+func TestGenerateZoneFileDefaultsToDateSerials(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1", Ttl: 300}}
+	generatedAt := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{GeneratedAt: generatedAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(zoneFile, "\t2026101401\t") {
+		t.Errorf("zone file does not hold the date serial 2026101401:\n%s", zoneFile)
+	}
+}
+
+func TestIncreasingSerials(t *testing.T) {
+	soa := func(serial string) string {
+		return "$ORIGIN example.com.\n@\tIN\tSOA\tdns1.p01.nsone.net.\thostmaster.nsone.net.\t" + serial + "\t43200\t7200\t1209600\t3600\nwww\tIN\tA\t192.0.2.1\n"
+	}
+
+	tests := []struct {
+		previous, serial, want string
+	}{
+		{"2026101301", "2026101401", "2026101401"},
+		{"2026101401", "2026101401", "2026101402"},
+		{"3735928559", "2026101401", "3735928560"},
+	}
+	for _, test := range tests {
+		got := increasingSerials(soa(test.previous), soa(test.serial))
+		if got != soa(test.want) {
+			t.Errorf("replacing serial %s with %s: got\n%s\nwant serial %s", test.previous, test.serial, got, test.want)
+		}
+	}
+
+	if withoutGenerationTime(soa("2026101301")) != withoutGenerationTime(soa("2026101401")) {
+		t.Error("zone files only differing in their serial should compare equal")
+	}
+}
+
+// cancellingFetcher cancels the run as soon as zones are listed, and waits
+// for the cancellation before returning records
+type cancellingFetcher struct {
+	MemoryZoneFetcher
+	cancel context.CancelFunc
+}
+
+func (f *cancellingFetcher) GetAllDnsZones(ctx context.Context) ([]DnsZone, error) {
+	f.cancel()
+	return f.MemoryZoneFetcher.GetAllDnsZones(ctx)
+}
+
+func (f *cancellingFetcher) GetAllDnsRecords(ctx context.Context, zoneId string) ([]DnsRecord, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetcher := &cancellingFetcher{
+		MemoryZoneFetcher: MemoryZoneFetcher{Zones: []DnsZone{{Id: "z1", Name: "example.com"}}},
+		cancel:            cancel,
+	}
+	dir := t.TempDir()
+
+	err := Run(Options{Token: "token", OutDir: dir, Quiet: true}, RunEnv{
+		Context:   ctx,
+		Stdout:    io.Discard,
+		Stderr:    io.Discard,
+		NewClient: func(string, ...ClientOption) ZoneApplier { return fetcher },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+	if ExitCode(err) != ExitFailure {
+		t.Errorf("got exit code %d, want %d", ExitCode(err), ExitFailure)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("got %d files in the output directory, want none", len(entries))
+	}
+}
+
+func TestClientStopsWhenCancelledMidRequest(t *testing.T) {
+	var requests atomic.Int32
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL), WithRetries(3, time.Millisecond))
+	_, err := client.GetAllDnsRecords(ctx, "z1")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want the cancelled one not to be retried", got)
+	}
+}
+
+// cancellingWriter cancels the run the first time it is written to
+type cancellingWriter struct {
+	cancel context.CancelFunc
+}
+
+func (w cancellingWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return len(p), nil
+}
+
+func TestRunStopsBetweenZoneFilesWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+
+	// The name of the first zone file is printed once it is written, which
+	// interrupts the run before the second
+	err := Run(Options{Token: "token", OutDir: dir, Quiet: true, NoTimestamp: true}, RunEnv{
+		Context:   ctx,
+		Stdout:    cancellingWriter{cancel},
+		Stderr:    io.Discard,
+		Getenv:    func(string) string { return "" },
+		NewClient: func(string, ...ClientOption) ZoneApplier { return exampleFetcher() },
+	})
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "after writing 1 of 2") {
+		t.Fatalf("got error %v, want an interruption after the first zone", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "example.com.zone" {
+		t.Fatalf("got files %v, want example.com.zone alone", entries)
+	}
+	contents, err := os.ReadFile(filepath.Join(dir, "example.com.zone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := ValidateZoneFile(string(contents)); err != nil || len(problems) != 0 {
+		t.Errorf("interrupted zone file is incomplete: %v %v\n%s", problems, err, contents)
+	}
+}
+
+func TestGetAllDnsZonesFollowsNextLinksOnTheApiHost(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("got Authorization %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", "<"+server.URL+"/dns_zones?page=2>; rel=\"next\"")
+			fmt.Fprint(w, `[{"id": "z1", "name": "example.com"}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id": "z2", "name": "example.org"}]`)
+		default:
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL))
+	zones, err := client.GetAllDnsZones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zones) != 2 || zones[0].Id != "z1" || zones[1].Id != "z2" {
+		t.Errorf("got zones %+v, want z1 and z2", zones)
+	}
+}
+
+func TestGetAllDnsRecordsFollowsNextLinks(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dns_zones/z1/dns_records" {
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", "<"+server.URL+"/dns_zones/z1/dns_records?page=2&per_page=100>; rel=\"next\", <"+server.URL+"/dns_zones/z1/dns_records?page=2&per_page=100>; rel=\"last\"")
+			fmt.Fprint(w, `[{"id": "r1", "hostname": "example.com", "type": "A", "value": "192.0.2.1"}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id": "r2", "hostname": "www.example.com", "type": "CNAME", "value": "example.com"}]`)
+		default:
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL))
+	records, err := client.GetAllDnsRecords(context.Background(), "z1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Id != "r1" || records[1].Id != "r2" {
+		t.Errorf("got records %+v, want r1 and r2", records)
+	}
+}
+
+func TestGetAllDnsZonesRefusesNextLinksToOtherHosts(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request with Authorization %q sent to another host", r.Header.Get("Authorization"))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "<"+other.URL+"/dns_zones?page=2>; rel=\"next\"")
+		fmt.Fprint(w, `[{"id": "z1", "name": "example.com"}]`)
+	}))
+	defer server.Close()
+
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL))
+	if _, err := client.GetAllDnsZones(context.Background()); err == nil {
+		t.Error("got no error for a next page link to another host")
+	}
+}
+
+func TestDeleteDnsRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		notFound bool
+		failed   bool
+	}{
+		{"deleted", http.StatusNoContent, false, false},
+		{"not found", http.StatusNotFound, true, true},
+		{"server error", http.StatusInternalServerError, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.Method != http.MethodDelete || r.URL.Path != "/dns_zones/z1/dns_records/r1" {
+					t.Errorf("got request %s %s", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			client := NewNetlifyDnsClient("token", WithBaseURL(server.URL), WithRetries(3, time.Millisecond))
+			err := client.DeleteDnsRecord(context.Background(), "z1", "r1")
+			if (err != nil) != test.failed {
+				t.Errorf("got error %v", err)
+			}
+			if errors.Is(err, ErrNotFound) != test.notFound {
+				t.Errorf("got error %v, matching ErrNotFound: %v", err, !test.notFound)
+			}
+			if requests != 1 {
+				t.Errorf("got %d requests, want 1 as deletions are not retried", requests)
+			}
+		})
+	}
+}
+
+func TestQuoteTxt(t *testing.T) {
+	tests := []struct {
+		name, value, want string
+	}{
+		{"plain", "v=spf1 -all", `"v=spf1 -all"`},
+		{"quoted", `"v=spf1 -all"`, `"v=spf1 -all"`},
+		{"several quoted strings", `"v=DKIM1; k=rsa; " "p=MIGf"`, `"v=DKIM1; k=rsa; " "p=MIGf"`},
+		{"embedded quotes", `say "hi"`, `"say \"hi\""`},
+		{"control characters", "line one\nline two\ttab", `"line one\010line two\009tab"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := quoteTxt(test.value); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileSplitsLongTxtRecords(t *testing.T) {
+	dkim := "v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A", 19)[:582]
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{{Hostname: "default._domainkey.example.com", Type: "TXT", Value: dkim, Ttl: 300}}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "default._domainkey\tIN\tTXT\t" + quoteString(dkim[:255]) + " " + quoteString(dkim[255:510]) + " " + quoteString(dkim[510:])
+	if got := recordLines(t, zoneFile); len(got) != 1 || got[0] != want {
+		t.Fatalf("got record lines %q, want %q", got, want)
+	}
+
+	parsed, err := ParseZoneFile(strings.NewReader(zoneFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 1 || parsed[0].Value != dkim {
+		t.Errorf("got parsed records %+v, want the %d character DKIM key back", parsed, len(dkim))
+	}
+}
+
+func TestGetAllDnsZonesReturnsApiErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		unauthorized bool
+		message      string
+	}{
+		{"unauthorized", http.StatusUnauthorized, true, `unauthorized (401) on dns_zones: {"code":401,"message":"nope"}`},
+		{"server error", http.StatusInternalServerError, false, `internal server error (500) on dns_zones: {"code":500,"message":"nope"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"code":`+strconv.Itoa(test.status)+`,"message":"nope"}`, test.status)
+			}))
+			defer server.Close()
+
+			client := NewNetlifyDnsClient("token", WithBaseURL(server.URL), WithRetries(1, time.Millisecond))
+			zones, err := client.GetAllDnsZones(context.Background())
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("got zones %v and error %v, want an APIError", zones, err)
+			}
+			if apiErr.StatusCode != test.status || apiErr.Endpoint != "dns_zones" || !strings.Contains(apiErr.Body, "nope") {
+				t.Errorf("got %+v", apiErr)
+			}
+			if got := apiErr.Error(); got != test.message {
+				t.Errorf("got message %q, want %q", got, test.message)
+			}
+			if errors.Is(err, ErrUnauthorized) != test.unauthorized {
+				t.Errorf("got error %v, matching ErrUnauthorized: %v", err, !test.unauthorized)
+			}
+		})
+	}
+}
+
+// soaFields returns the fields following SOA on the SOA line of zoneFile
+func soaFields(t *testing.T, zoneFile string) []string {
+	t.Helper()
+	for _, line := range strings.Split(zoneFile, "\n") {
+		fields := strings.Split(line, "\t")
+		for i, field := range fields {
+			if field == "SOA" {
+				return fields[i+1:]
+			}
+		}
+	}
+	t.Fatalf("no SOA record in:\n%s", zoneFile)
+	return nil
+}
+
+func TestGenerateZoneFileWritesSoaRecord(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600}}
+
+	tests := []struct {
+		name string
+		opts ZoneOptions
+		want []string
+	}{
+		{
+			"defaults",
+			ZoneOptions{Serial: 2026101401},
+			[]string{"dns1.p01.nsone.net.", "hostmaster.nsone.net.", "2026101401", "43200", "7200", "1209600", "3600"},
+		},
+		{
+			"custom",
+			ZoneOptions{
+				PrimaryNameserver: "ns1.example.com",
+				AdminEmail:        "dns.admin@example.com",
+				Serial:            7,
+				Refresh:           3600,
+				Retry:             600,
+				Expire:            604800,
+				Minimum:           300,
+			},
+			[]string{"ns1.example.com.", "dns\\.admin.example.com.", "7", "3600", "600", "604800", "300"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zoneFile, err := GenerateZoneFile(zone, records, nil, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := soaFields(t, zoneFile); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got SOA fields %q, want %q", got, test.want)
+			}
+			if !strings.Contains(zoneFile, "$TTL 3600\n@\tIN\t") {
+				t.Errorf("SOA record does not follow the directives:\n%s", zoneFile)
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileWritesMxPriority(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 3600},
+		{Hostname: "example.com", Type: "MX", Value: "backup.example.net.", Priority: 20, Ttl: 3600},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"@\tIN\tMX\t10\tmail.example.com.",
+		"@\tIN\tMX\t20\tbackup.example.net.",
+	}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
+
+func TestGenerateZoneFileWritesCaaRecords(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "CAA", Value: "letsencrypt.org", Flag: stringPtr("0"), Tag: stringPtr("issue"), Ttl: 3600},
+		{Hostname: "example.com", Type: "CAA", Value: ";", Flag: stringPtr("128"), Tag: stringPtr("issuewild"), Ttl: 3600},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"@\tIN\tCAA\t128\tissuewild\t\";\"",
+		"@\tIN\tCAA\t0\tissue\t\"letsencrypt.org\"",
+	}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
+
+func TestGenerateZoneFileOmitsDefaultTtls(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+		{Hostname: "mail.example.com", Type: "A", Value: "192.0.2.2", Ttl: 3600},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.3", Ttl: 300},
+	}
+
+	tests := []struct {
+		name      string
+		opts      ZoneOptions
+		directive string
+		want      []string
+	}{
+		{"most common", ZoneOptions{}, "$TTL 3600\n", []string{
+			"@\tIN\tA\t192.0.2.1",
+			"mail\tIN\tA\t192.0.2.2",
+			"www\tIN\t300\tA\t192.0.2.3",
+		}},
+		{"explicit", ZoneOptions{DefaultTtl: 300}, "$TTL 300\n", []string{
+			"@\tIN\t3600\tA\t192.0.2.1",
+			"mail\tIN\t3600\tA\t192.0.2.2",
+			"www\tIN\tA\t192.0.2.3",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zoneFile, err := GenerateZoneFile(zone, records, nil, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(zoneFile, "\n"+test.directive) {
+				t.Errorf("zone file does not hold %q:\n%s", test.directive, zoneFile)
+			}
+			if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got record lines %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// exampleFetcher serves example.com and example.org with a few records each
+func exampleFetcher() *MemoryZoneFetcher {
+	return &MemoryZoneFetcher{
+		Zones: []DnsZone{{Id: "z1", Name: "example.com"}, {Id: "z2", Name: "example.org"}},
+		Records: map[string][]DnsRecord{
+			"z1": {
+				{Id: "r1", Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+				{Id: "r2", Hostname: "www.example.com", Type: "CNAME", Value: "example.com", Ttl: 3600},
+			},
+			"z2": {
+				{Id: "r3", Hostname: "example.org", Type: "A", Value: "192.0.2.2", Ttl: 3600},
+			},
+		},
+	}
+}
+
+// runZones runs Run with opts against fetcher, with a token and an empty
+// environment, returning what it wrote to stdout and stderr
+func runZones(t *testing.T, fetcher ZoneApplier, opts Options) (string, string, error) {
+	t.Helper()
+	if opts.Token == "" {
+		opts.Token = "token"
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := Run(opts, RunEnv{
+		Stdout:    &stdout,
+		Stderr:    &stderr,
+		Getenv:    func(string) string { return "" },
+		NewClient: func(string, ...ClientOption) ZoneApplier { return fetcher },
+	})
+	return stdout.String(), stderr.String(), err
+}
+
+func TestRunWritesZonesToStdout(t *testing.T) {
+	dir := t.TempDir()
+	stdout, _, err := runZones(t, exampleFetcher(), Options{Stdout: true, OutDir: dir, NoTimestamp: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"$ORIGIN example.com.\n", "www\tIN\tCNAME\texample.com.\n", "$ORIGIN example.org.\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout does not hold %q:\n%s", want, stdout)
+		}
+	}
+	if strings.Index(stdout, "example.com.") > strings.Index(stdout, "example.org.") {
+		t.Errorf("zones are not printed in the order Netlify returned them:\n%s", stdout)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("got %d files in the output directory, want none", len(entries))
+	}
+}
+
+func TestRunWritesZoneFilesToOutDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "zones")
+	_, _, err := runZones(t, exampleFetcher(), Options{OutDir: dir, NoTimestamp: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"example.com.zone", "example.org.zone"} {
+		contents, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !strings.Contains(string(contents), "\tSOA\t") {
+			t.Errorf("%s is not a zone file:\n%s", name, contents)
+		}
+	}
+}
+
+func TestRunNamesZoneFiles(t *testing.T) {
+	tests := []struct {
+		fileNaming string
+		want       []string
+	}{
+		{"name", []string{"example.com.zone", "example.org.zone"}},
+		{"id", []string{"z1.zone", "z2.zone"}},
+	}
+	for _, test := range tests {
+		t.Run(test.fileNaming, func(t *testing.T) {
+			dir := t.TempDir()
+			stdout, _, err := runZones(t, exampleFetcher(), Options{OutDir: dir, FileNaming: test.fileNaming})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			entries, _ := os.ReadDir(dir)
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got files %q, want %q", got, test.want)
+			}
+			for _, name := range test.want {
+				if !strings.Contains(stdout, name) {
+					t.Errorf("stdout does not list %s:\n%s", name, stdout)
+				}
+			}
+		})
+	}
+}
+
+func TestRunFiltersZonesByName(t *testing.T) {
+	stdout, _, err := runZones(t, exampleFetcher(), Options{Stdout: true, Zones: []string{"EXAMPLE.org."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout, "$ORIGIN example.org.") || strings.Contains(stdout, "example.com") {
+		t.Errorf("got output for other zones than example.org:\n%s", stdout)
+	}
+
+	stdout, _, err = runZones(t, exampleFetcher(), Options{Stdout: true, Zones: []string{"example.net"}})
+	if err == nil || !strings.Contains(err.Error(), "example.net") {
+		t.Errorf("got error %v for a zone that does not exist, want one naming it", err)
+	}
+	if stdout != "" {
+		t.Errorf("got output for a zone that does not exist:\n%s", stdout)
+	}
+}
+
+func TestRunUsesApiUrl(t *testing.T) {
+	server := zoneServer(t, "example.com")
+	var stdout bytes.Buffer
+	err := Run(Options{Token: "token", APIURL: server.URL + "/", Stdout: true}, RunEnv{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		Getenv: func(string) string { return "" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "www\tIN\tA\t192.0.2.1\n") {
+		t.Errorf("output does not hold the records served by %s:\n%s", server.URL, stdout.String())
+	}
+}
+
+func TestGetAllDnsZonesRetriesTransientFailures(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		default:
+			fmt.Fprint(w, `[{"id": "z1", "name": "example.com"}]`)
+		}
+	}))
+	defer server.Close()
+
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL), WithRetries(4, time.Millisecond))
+	zones, err := client.GetAllDnsZones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zones) != 1 || requests != 3 {
+		t.Errorf("got zones %+v after %d requests, want example.com after 3", zones, requests)
+	}
+}
+
+func TestGetAllDnsZonesGivesUpAfterMaxAttempts(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL), WithRetries(2, time.Millisecond))
+	if _, err := client.GetAllDnsZones(context.Background()); err == nil || requests != 2 {
+		t.Errorf("got error %v after %d requests, want an error after 2", err, requests)
+	}
+}
+
+func TestRateLimiterWaitsWhenFewRequestsRemain(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	plenty := &rateLimiter{threshold: defaultRateLimitThreshold}
+	plenty.update(http.Header{"X-Ratelimit-Remaining": {"100"}, "X-Ratelimit-Reset": {reset}})
+	if err := plenty.wait(context.Background()); err != nil {
+		t.Errorf("got error %v with plenty of requests remaining, want no wait", err)
+	}
+
+	low := &rateLimiter{threshold: defaultRateLimitThreshold}
+	low.update(http.Header{"X-Ratelimit-Remaining": {"2"}, "X-Ratelimit-Reset": {reset}})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := low.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v with 2 requests remaining, want a wait until the reset", err)
+	}
+}
+
+func TestGetAllDnsZonesTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL), WithTimeout(20*time.Millisecond), WithRetries(1, time.Millisecond))
+	started := time.Now()
+	_, err := client.GetAllDnsZones(context.Background())
+	var netErr interface{ Timeout() bool }
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("request took %v despite a 20ms timeout", elapsed)
+	}
+}
+
+func TestGenerateZoneFileWritesPtrRecords(t *testing.T) {
+	zone := DnsZone{Name: "2.0.192.in-addr.arpa"}
+	records := []DnsRecord{
+		{Hostname: "1.2.0.192.in-addr.arpa", Type: "PTR", Value: "host.example.com", Ttl: 3600},
+		{Hostname: "10.2.0.192.in-addr.arpa", Type: "PTR", Value: "mail.example.com.", Ttl: 3600},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(zoneFile, "$ORIGIN 2.0.192.in-addr.arpa.\n") {
+		t.Errorf("zone file does not have the reverse zone as origin:\n%s", zoneFile)
+	}
+	want := []string{
+		"1\tIN\tPTR\thost.example.com.",
+		"10\tIN\tPTR\tmail.example.com.",
+	}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
+
+func TestGenerateZoneFileWritesNsRecords(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "NS", Value: "dns1.p01.nsone.net", Ttl: 3600},
+		{Hostname: "example.com", Type: "NS", Value: "dns2.p01.nsone.net", Ttl: 3600},
+		{Hostname: "sub.example.com", Type: "NS", Value: "ns1.other.net", Ttl: 3600},
+		{Hostname: "ns1.sub.example.com", Type: "A", Value: "192.0.2.53", Ttl: 3600},
+	}
+
+	tests := []struct {
+		name string
+		opts ZoneOptions
+		want []string
+	}{
+		{"apex and delegation", ZoneOptions{}, []string{
+			"@\tIN\tNS\tdns1.p01.nsone.net.",
+			"@\tIN\tNS\tdns2.p01.nsone.net.",
+			"ns1.sub\tIN\tA\t192.0.2.53",
+			"sub\tIN\tNS\tns1.other.net.",
+		}},
+		{"without apex", ZoneOptions{OmitApexNS: true}, []string{
+			"ns1.sub\tIN\tA\t192.0.2.53",
+			"sub\tIN\tNS\tns1.other.net.",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zoneFile, err := GenerateZoneFile(zone, records, nil, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got record lines %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunDryRunWritesNoFiles(t *testing.T) {
+	dir := t.TempDir()
+	stdout, stderr, err := runZones(t, exampleFetcher(), Options{OutDir: dir, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("got %d files in the output directory, want none", len(entries))
+	}
+	if stdout != "" {
+		t.Errorf("got stdout %q, want nothing", stdout)
+	}
+	for _, name := range []string{"example.com.zone", "example.org.zone"} {
+		if !strings.Contains(stderr, "would write zone file") || !strings.Contains(stderr, filepath.Join(dir, name)) {
+			t.Errorf("stderr does not report %s:\n%s", name, stderr)
+		}
+	}
+}
+
+func TestGenerateZoneFileSortsRecords(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.2", Ttl: 300},
+		{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 20, Ttl: 300},
+		{Hostname: "api.example.com", Type: "AAAA", Value: "2001:db8::1", Ttl: 300},
+		{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 300},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1", Ttl: 300},
+		{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 300},
+	}
+	reversed := make([]DnsRecord, len(records))
+	for i, record := range records {
+		reversed[len(records)-1-i] = record
+	}
+
+	opts := ZoneOptions{GeneratedAt: time.Date(2026, time.October, 14, 0, 0, 0, 0, time.UTC)}
+	first, err := GenerateZoneFile(zone, records, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateZoneFile(zone, reversed, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("zone files differ with the records in another order:\n%s\n%s", first, second)
+	}
+
+	want := []string{
+		"@\tIN\tA\t192.0.2.1",
+		"@\tIN\tMX\t10\tmail.example.com.",
+		"@\tIN\tMX\t20\tmail.example.com.",
+		"api\tIN\tAAAA\t2001:db8::1",
+		"www\tIN\tA\t192.0.2.1",
+		"www\tIN\tA\t192.0.2.2",
+	}
+	if got := recordLines(t, first); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
+
+func TestResolveToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	withEnv := func(name string) string {
+		if name == "NETLIFY_TOKEN" {
+			return "env-token"
+		}
+		return ""
+	}
+	noEnv := func(string) string { return "" }
+
+	tests := []struct {
+		name            string
+		flagToken, file string
+		getenv          func(string) string
+		want            string
+		failed          bool
+	}{
+		{"flag wins", "flag-token", tokenFile, withEnv, "flag-token", false},
+		{"file over environment", "", tokenFile, withEnv, "file-token", false},
+		{"environment", "", "", withEnv, "env-token", false},
+		{"none", "", "", noEnv, "", true},
+		{"empty file", "", emptyFile, withEnv, "", true},
+		{"missing file", "", filepath.Join(dir, "missing"), withEnv, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := resolveToken(test.flagToken, test.file, false, test.getenv)
+			if token != test.want || (err != nil) != test.failed {
+				t.Errorf("got %q, %v, want %q", token, err, test.want)
+			}
+		})
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	local, _, err := runZones(t, exampleFetcher(), Options{Stdout: true, Zones: []string{"example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "example.com.zone")
+	if err := os.WriteFile(path, []byte(local), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, err := runZones(t, exampleFetcher(), Options{DiffPath: path, Zones: []string{"example.com"}})
+	if ExitCode(err) != ExitOK || stdout != "" {
+		t.Errorf("got exit code %d and output %q for identical zones, want %d and nothing", ExitCode(err), stdout, ExitOK)
+	}
+
+	changed := exampleFetcher()
+	changed.Records["z1"][0].Value = "192.0.2.9"
+	stdout, _, err = runZones(t, changed, Options{DiffPath: path, Zones: []string{"example.com"}})
+	if ExitCode(err) != ExitDiffer {
+		t.Errorf("got exit code %d for changed zones, want %d", ExitCode(err), ExitDiffer)
+	}
+	for _, want := range []string{"- @ in a 192.0.2.1\n", "+ @ in a 192.0.2.9\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("diff does not hold %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestCreateDnsRecordSendsRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		record DnsRecord
+		want   string
+	}{
+		{
+			"MX",
+			DnsRecord{Hostname: "example.com", Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 3600},
+			`{"type":"MX","hostname":"example.com","value":"mail.example.com","ttl":3600,"priority":10}`,
+		},
+		{
+			"SRV",
+			DnsRecord{Hostname: "_sip._tcp.example.com", Type: "SRV", Value: "sip.example.com", Priority: 10, Weight: intPtr(5), Port: intPtr(5060)},
+			`{"type":"SRV","hostname":"_sip._tcp.example.com","value":"sip.example.com","priority":10,"weight":5,"port":5060}`,
+		},
+		{
+			"A without priority",
+			DnsRecord{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1", Priority: 10, Ttl: 300},
+			`{"type":"A","hostname":"www.example.com","value":"192.0.2.1","ttl":300}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if r.Method != http.MethodPost || r.URL.Path != "/dns_zones/z1/dns_records" {
+					t.Errorf("got request %s %s", r.Method, r.URL.Path)
+				}
+				if r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("got Content-Type %q", r.Header.Get("Content-Type"))
+				}
+				if string(body) != test.want {
+					t.Errorf("got body %s, want %s", body, test.want)
+				}
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprintf(w, `{"id": "r1", "dns_zone_id": "z1", "hostname": %q, "type": %q}`, test.record.Hostname, test.record.Type)
+			}))
+			defer server.Close()
+
+			client := NewNetlifyDnsClient("token", WithBaseURL(server.URL))
+			created, err := client.CreateDnsRecord(context.Background(), "z1", test.record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created.Id != "r1" || created.Hostname != test.record.Hostname {
+				t.Errorf("got created record %+v", created)
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileConvertsUnicodeNames(t *testing.T) {
+	zone := DnsZone{Name: "bücher.example"}
+	records := []DnsRecord{
+		{Hostname: "bücher.example", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+		{Hostname: "www.bücher.example", Type: "CNAME", Value: "münchen.example", Ttl: 3600},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{UnicodeComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(zoneFile, "$ORIGIN xn--bcher-kva.example.\t; bücher.example\n") {
+		t.Errorf("origin is not in punycode with its Unicode form as comment:\n%s", zoneFile)
+	}
+	want := []string{
+		"@\tIN\tA\t192.0.2.1\t; bücher.example",
+		"www\tIN\tCNAME\txn--mnchen-3ya.example.\t; www.bücher.example",
+	}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
+
+// failingFetcher fails to list zones
+type failingFetcher struct {
+	MemoryZoneFetcher
+}
+
+func (f *failingFetcher) GetAllDnsZones(ctx context.Context) ([]DnsZone, error) {
+	return nil, &APIError{StatusCode: http.StatusBadGateway, Endpoint: "dns_zones"}
+}
+
+func TestRunReturnsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fetcher ZoneApplier
+		opts    Options
+		want    int
+	}{
+		{"conflicting flags", exampleFetcher(), Options{Verbose: true, Quiet: true}, ExitUsage},
+		{"unknown format", exampleFetcher(), Options{Format: "xml"}, ExitUsage},
+		{"listing zones fails", &failingFetcher{}, Options{}, ExitFailure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.opts.OutDir = t.TempDir()
+			_, _, err := runZones(t, test.fetcher, test.opts)
+			if err == nil || ExitCode(err) != test.want {
+				t.Errorf("got error %v with exit code %d, want exit code %d", err, ExitCode(err), test.want)
+			}
+			if entries, _ := os.ReadDir(test.opts.OutDir); len(entries) != 0 {
+				t.Errorf("got %d files in the output directory, want none", len(entries))
+			}
+		})
+	}
+
+	var stderr bytes.Buffer
+	err := Run(Options{OutDir: t.TempDir()}, RunEnv{Stdout: io.Discard, Stderr: &stderr, Getenv: func(string) string { return "" }})
+	if err == nil || !strings.Contains(err.Error(), "no Netlify token") {
+		t.Errorf("got error %v without a token, want one asking for it", err)
+	}
+}
+
+func TestRunWritesOtherZonesWhenOneFails(t *testing.T) {
+	fetcher := exampleFetcher()
+	fetcher.Zones = append(fetcher.Zones, DnsZone{Id: "z3", Name: "example.net"})
+	fetcher.Errors = map[string]error{"z2": &APIError{StatusCode: http.StatusInternalServerError, Endpoint: "dns_zones/z2/dns_records"}}
+	fetcher.Records["z3"] = []DnsRecord{{Hostname: "example.net", Type: "A", Value: "192.0.2.3", Ttl: 3600}}
+	dir := t.TempDir()
+
+	_, _, err := runZones(t, fetcher, Options{OutDir: dir})
+	if ExitCode(err) != ExitFailure || !strings.Contains(err.Error(), "dns_zones/z2") {
+		t.Errorf("got error %v with exit code %d, want the error of example.org and exit code %d", err, ExitCode(err), ExitFailure)
+	}
+
+	var got []string
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	if want := []string{"example.com.zone", "example.net.zone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got files %q, want %q", got, want)
+	}
+}
+
+func TestGenerateZoneFileWritesHeader(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+	}
+
+	stamped, err := GenerateZoneFile(zone, records, nil, ZoneOptions{GeneratedAt: time.Date(2026, time.October, 14, 9, 30, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ";\n; Zone example.com exported from Netlify, 2 record(s)\n; Generated by netlify-dns-zone-file " + Version + " at 2026-10-14T09:30:00Z\n;\n$ORIGIN example.com.\n"
+	if !strings.HasPrefix(stamped, want) {
+		t.Errorf("zone file does not start with\n%s\ngot:\n%s", want, stamped)
+	}
+
+	stdout, _, err := runZones(t, exampleFetcher(), Options{Stdout: true, Zones: []string{"example.com"}, NoTimestamp: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout, "; Generated by netlify-dns-zone-file "+Version+"\n") {
+		t.Errorf("output with NoTimestamp holds a generation time:\n%s", stdout)
+	}
+}
+
+func TestGenerateZoneFileAnnotatesNetlifyRecords(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "www.example.com", Type: "NETLIFY", Value: "example.netlify.app", Ttl: 3600},
+		{Hostname: "v6.example.com", Type: "NETLIFYv6", Value: "example.netlify.app", Ttl: 3600},
+		{Hostname: "docs.example.com", Type: "CNAME", Value: "example.netlify.app", Ttl: 3600},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{AnnotateNetlify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"docs\tIN\tCNAME\texample.netlify.app.",
+		"v6\tIN\tCNAME\texample.netlify.app.\t; netlify-managed (NETLIFYv6)",
+		"www\tIN\tCNAME\texample.netlify.app.\t; netlify-managed (NETLIFY)",
+	}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
+
+// recordingTransport answers every request with body, keeping the requests
+// it was sent
+type recordingTransport struct {
+	body     string
+	requests []*http.Request
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.requests = append(r.requests, req)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(r.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestClientSendsRequestsThroughTransport(t *testing.T) {
+	transport := &recordingTransport{body: `[{"id": "z1", "name": "example.com"}]`}
+	client := NewNetlifyDnsClient("token", WithTransport(transport))
+
+	zones, err := client.GetAllDnsZones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zones) != 1 || zones[0].Name != "example.com" {
+		t.Errorf("got zones %+v, want example.com", zones)
+	}
+	if len(transport.requests) != 1 {
+		t.Fatalf("got %d requests through the transport, want 1", len(transport.requests))
+	}
+	if got := transport.requests[0].URL.String(); got != DefaultAPIURL+"dns_zones?per_page=100" {
+		t.Errorf("got request for %s", got)
+	}
+}
+
+func TestClientSendsUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want string
+	}{
+		{"default", nil, "netlify-zone-file/" + Version},
+		{"custom", []ClientOption{WithUserAgent("my-tool/1.0")}, "my-tool/1.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &recordingTransport{body: `[]`}
+			client := NewNetlifyDnsClient("token", append([]ClientOption{WithTransport(transport)}, test.opts...)...)
+			if _, err := client.GetAllDnsZones(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := transport.requests[0].Header.Get("User-Agent"); got != test.want {
+				t.Errorf("got User-Agent %q, want %q", got, test.want)
+			}
+			if got := transport.requests[0].Header.Get("Authorization"); got != "Bearer token" {
+				t.Errorf("got Authorization %q", got)
+			}
+		})
+	}
+}
+
+func TestGetDnsZone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dns_zones/z1" {
+			http.Error(w, `{"code":404,"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"id": "z1", "name": "example.com"}`)
+	}))
+	defer server.Close()
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL))
+
+	zone, err := client.GetDnsZone(context.Background(), "z1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.Id != "z1" || zone.Name != "example.com" {
+		t.Errorf("got zone %+v, want example.com", zone)
+	}
+
+	_, err = client.GetDnsZone(context.Background(), "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v for a missing zone, want ErrNotFound", err)
+	}
+}
+
+func TestGetDnsRecord(t *testing.T) {
+	transport := &recordingTransport{body: `{"id": "r1", "dns_zone_id": "z1", "hostname": "mail.example.com",
+		"type": "MX", "ttl": 300, "priority": 10, "managed": true, "value": "mx.example.net"}`}
+	client := NewNetlifyDnsClient("token", WithBaseURL("https://api.example.test/api/v1/"), WithTransport(transport))
+
+	record, err := client.GetDnsRecord(context.Background(), "z1", "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(transport.requests))
+	}
+	if got, want := transport.requests[0].URL.String(), "https://api.example.test/api/v1/dns_zones/z1/dns_records/r1"; got != want {
+		t.Errorf("got URL %s, want %s", got, want)
+	}
+	want := DnsRecord{Id: "r1", DnsZoneId: "z1", Hostname: "mail.example.com", Type: "MX", Ttl: 300,
+		Priority: 10, Managed: true, Value: "mx.example.net"}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("got record %+v, want %+v", record, want)
+	}
+}
+
+func TestGenerateZoneFileSkipsInvalidHostnames(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	tests := []struct {
+		name     string
+		hostname string
+	}{
+		{"overlong label", strings.Repeat("a", 64) + ".example.com"},
+		{"embedded space", "my host.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records := []DnsRecord{
+				{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1"},
+				{Hostname: test.hostname, Type: "A", Value: "192.0.2.2"},
+			}
+
+			zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := recordLines(t, zoneFile)
+			want := "www\tIN\tA\t192.0.2.1"
+			if len(got) != 1 || got[0] != want {
+				t.Errorf("got record lines %q, want only %q", got, want)
+			}
+
+			_, err = GenerateZoneFile(zone, records, nil, ZoneOptions{Strict: true})
+			var invalid validationError
+			if !errors.As(err, &invalid) {
+				t.Errorf("got error %v with Strict, want a validation error", err)
+			}
+		})
+	}
+}
+
+func TestRunPrintsVersion(t *testing.T) {
+	var stdout bytes.Buffer
+	err := Run(Options{ShowVersion: true}, RunEnv{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		Getenv: func(string) string { return "" },
+		NewClient: func(string, ...ClientOption) ZoneApplier {
+			t.Error("the version was printed after building a client")
+			return exampleFetcher()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stdout.String(), "netlify-dns-zone-file "+Version) || !strings.HasSuffix(stdout.String(), "\n") {
+		t.Errorf("got %q, want the version line", stdout.String())
+	}
+}
+
+func TestRunWritesSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "all.zone")
+	stdout, _, err := runZones(t, exampleFetcher(), Options{SingleFile: path, OutDir: dir, NoTimestamp: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout != path+"\n" {
+		t.Errorf("got stdout %q, want the single file's name", stdout)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	com := strings.Index(string(contents), "$ORIGIN example.com.\n")
+	org := strings.Index(string(contents), "$ORIGIN example.org.\n")
+	if com < 0 || org < com {
+		t.Errorf("want both origins, example.com first:\n%s", contents)
+	}
+	if !strings.Contains(string(contents), "\n\n;\n; Zone example.org") {
+		t.Errorf("want the zones separated by a blank line:\n%s", contents)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files in the output directory, want only the single file", len(entries))
+	}
+}
+
+func TestGenerateZoneFileHandlesTrailingDots(t *testing.T) {
+	want := []string{
+		"@\tIN\tMX\t10\tmail.example.net.",
+		"www\tIN\tCNAME\texample.net.",
+	}
+	for _, dot := range []string{"", "."} {
+		t.Run(fmt.Sprintf("dot=%q", dot), func(t *testing.T) {
+			zone := DnsZone{Name: "example.com" + dot}
+			records := []DnsRecord{
+				{Hostname: "example.com" + dot, Type: "MX", Priority: 10, Value: "mail.example.net" + dot},
+				{Hostname: "www.example.com" + dot, Type: "CNAME", Value: "example.net" + dot},
+			}
+
+			zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(zoneFile, "..") {
+				t.Errorf("zone file holds a double dot:\n%s", zoneFile)
+			}
+			if !strings.Contains(zoneFile, "$ORIGIN example.com.\n") {
+				t.Errorf("zone file is missing the origin:\n%s", zoneFile)
+			}
+			if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+				t.Errorf("got record lines %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileValidatesAddresses(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "v4.example.com", Type: "A", Value: "192.0.2.1"},
+		{Hostname: "wrong.example.com", Type: "A", Value: "2001:db8::1"},
+		{Hostname: "v6.example.com", Type: "AAAA", Value: "2001:db8::2"},
+	}
+
+	var logs bytes.Buffer
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{Logger: NewLogger(&logs, false, false)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"v4\tIN\tA\t192.0.2.1", "v6\tIN\tAAAA\t2001:db8::2", "wrong\tIN\tA\t2001:db8::1"}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+	if strings.Count(logs.String(), "invalid address") != 1 || !strings.Contains(logs.String(), "wrong.example.com") {
+		t.Errorf("want a single warning about the IPv6 value of the A record, got:\n%s", logs.String())
+	}
+
+	zoneFile, err = GenerateZoneFile(zone, records, nil, ZoneOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"v4\tIN\tA\t192.0.2.1", "v6\tIN\tAAAA\t2001:db8::2"}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q with Strict, want %q", got, want)
+	}
+}
+
+func TestWriteZoneFileMatchesGenerateZoneFile(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "A", Value: "192.0.2.1", Ttl: 3600},
+		{Hostname: "example.com", Type: "MX", Priority: 10, Value: "mail.example.com", Ttl: 3600},
+		{Hostname: "example.com", Type: "TXT", Value: "v=spf1 mx -all", Ttl: 300},
+		{Hostname: "www.example.com", Type: "CNAME", Value: "example.com", Ttl: 3600},
+	}
+	opts := ZoneOptions{GeneratedAt: time.Date(2026, time.October, 14, 9, 30, 0, 0, time.UTC), LineEnding: LineEndingCRLF}
+
+	generated, err := GenerateZoneFile(zone, records, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written bytes.Buffer
+	if err := WriteZoneFile(&written, zone, records, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if written.String() != generated {
+		t.Errorf("WriteZoneFile wrote\n%q\nGenerateZoneFile returned\n%q", written.String(), generated)
+	}
+}
+
+func TestGetAllDnsZonesFiltersByAccount(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []ClientOption
+		query url.Values
+	}{
+		{"all accounts", nil, url.Values{"per_page": {"100"}}},
+		{"one account", []ClientOption{WithAccountSlug("my-team")}, url.Values{"account_slug": {"my-team"}, "per_page": {"100"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &recordingTransport{body: `[{"id": "z1", "name": "example.com"}]`}
+			opts := append([]ClientOption{WithTransport(transport)}, test.opts...)
+			client := NewNetlifyDnsClient("token", opts...)
+
+			if _, err := client.GetAllDnsZones(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(transport.requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(transport.requests))
+			}
+			request := transport.requests[0]
+			if request.URL.Path != "/api/v1/dns_zones" {
+				t.Errorf("got path %s, want /api/v1/dns_zones", request.URL.Path)
+			}
+			if got := request.URL.Query(); !reflect.DeepEqual(got, test.query) {
+				t.Errorf("got query %v, want %v", got, test.query)
+			}
+		})
+	}
+}
+
+func TestRunRegeneratesZonesOffline(t *testing.T) {
+	cacheDir := t.TempDir()
+	opts := Options{Stdout: true, CacheDir: cacheDir, NoTimestamp: true}
+
+	online, _, err := runZones(t, exampleFetcher(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(online, "$ORIGIN example.org.\n") {
+		t.Fatalf("online output is missing example.org:\n%s", online)
+	}
+	if entries, err := os.ReadDir(cacheDir); err != nil || len(entries) == 0 {
+		t.Fatalf("got cache entries %v (%v), want the cached responses", entries, err)
+	}
+
+	opts.Offline = true
+	offline, _, err := runZones(t, &failingFetcher{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offline != online {
+		t.Errorf("offline output differs from the online one:\n%s\nwant:\n%s", offline, online)
+	}
+}
+
+func TestRunWarnsAboutEmptyZones(t *testing.T) {
+	fetcher := &MemoryZoneFetcher{Zones: []DnsZone{{Id: "z1", Name: "example.com"}}}
+
+	for _, failOnEmpty := range []bool{false, true} {
+		t.Run(fmt.Sprint("FailOnEmpty=", failOnEmpty), func(t *testing.T) {
+			dir := t.TempDir()
+			_, stderr, err := runZones(t, fetcher, Options{OutDir: dir, NoTimestamp: true, FailOnEmpty: failOnEmpty})
+			if failOnEmpty && ExitCode(err) != ExitFailure {
+				t.Errorf("got error %v, want exit code %d", err, ExitFailure)
+			}
+			if !failOnEmpty && err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stderr, "zone has no records") {
+				t.Errorf("stderr does not warn about the empty zone:\n%s", stderr)
+			}
+
+			contents, err := os.ReadFile(filepath.Join(dir, "example.com.zone"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(contents), "; Zone example.com exported from Netlify, 0 record(s)\n") {
+				t.Errorf("zone file is missing its header:\n%s", contents)
+			}
+			if got := recordLines(t, string(contents)); len(got) != 0 {
+				t.Errorf("got record lines %q, want none", got)
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileWritesCRLF(t *testing.T) {
+	fetcher := exampleFetcher()
+	zone := fetcher.Zones[0]
+	lf, err := GenerateZoneFile(zone, fetcher.Records[zone.Id], nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf, err := GenerateZoneFile(zone, fetcher.Records[zone.Id], nil, ZoneOptions{LineEnding: LineEndingCRLF})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(lf, "\r") {
+		t.Errorf("LF zone file holds a carriage return:\n%q", lf)
+	}
+	if strings.Count(crlf, "\n") != strings.Count(crlf, "\r\n") {
+		t.Errorf("CRLF zone file holds a bare line feed:\n%q", crlf)
+	}
+	if got := strings.ReplaceAll(crlf, "\r\n", "\n"); got != lf {
+		t.Errorf("CRLF zone file differs from the LF one by more than line endings:\n%q\nwant:\n%q", got, lf)
+	}
+}
+
+func TestZoneFileBaseName(t *testing.T) {
+	tests := []struct {
+		name    string
+		zone    DnsZone
+		naming  string
+		want    string
+		wantErr bool
+	}{
+		{"name", DnsZone{Id: "z1", Name: "example.com"}, "name", "example.com", false},
+		{"unsafe characters", DnsZone{Id: "z1", Name: "ex ample/com"}, "name", "ex_ample_com", false},
+		{"id", DnsZone{Id: "z1", Name: "example.com"}, "id", "z1", false},
+		{"parent directory name", DnsZone{Id: "z1", Name: "../etc"}, "name", "", true},
+		{"parent directory id", DnsZone{Id: "../z1", Name: "example.com"}, "id", "", true},
+		{"empty id", DnsZone{Name: "example.com"}, "id", "", true},
+		{"unknown naming", DnsZone{Id: "z1", Name: "example.com"}, "hash", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := zoneFileBaseName(test.zone, test.naming)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileWritesCAATags(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	caa := func(flag, tag, value string) DnsRecord {
+		return DnsRecord{Hostname: "example.com", Type: "CAA", Flag: stringPtr(flag), Tag: stringPtr(tag), Value: value}
+	}
+
+	tests := []struct {
+		name   string
+		record DnsRecord
+		want   string
+	}{
+		{"issue", caa("0", "issue", "letsencrypt.org"), "@\tIN\tCAA\t0\tissue\t\"letsencrypt.org\""},
+		{"issuewild", caa("0", "issuewild", ";"), "@\tIN\tCAA\t0\tissuewild\t\";\""},
+		{"iodef", caa("128", "iodef", "mailto:security@example.com"), "@\tIN\tCAA\t128\tiodef\t\"mailto:security@example.com\""},
+		{"defaults", DnsRecord{Hostname: "example.com", Type: "CAA", Value: "letsencrypt.org"}, "@\tIN\tCAA\t0\tissue\t\"letsencrypt.org\""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zoneFile, err := GenerateZoneFile(zone, []DnsRecord{test.record}, nil, ZoneOptions{Strict: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := recordLines(t, zoneFile); len(got) != 1 || got[0] != test.want {
+				t.Errorf("got record lines %q, want only %q", got, test.want)
+			}
+		})
+	}
+
+	t.Run("invalid tag", func(t *testing.T) {
+		records := []DnsRecord{caa("0", "issuer", "letsencrypt.org")}
+
+		var logs bytes.Buffer
+		zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{Logger: NewLogger(&logs, false, false)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := recordLines(t, zoneFile); len(got) != 1 {
+			t.Errorf("got record lines %q, want the record written", got)
+		}
+		if !strings.Contains(logs.String(), "invalid record data") {
+			t.Errorf("no warning about the tag in %q", logs.String())
+		}
+
+		zoneFile, err = GenerateZoneFile(zone, records, nil, ZoneOptions{Strict: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := recordLines(t, zoneFile); len(got) != 0 {
+			t.Errorf("got record lines %q with Strict, want none", got)
+		}
+	})
+}
+
+func TestGenerateZoneFilesIsolatesErrors(t *testing.T) {
+	zones := []DnsZone{{Id: "z1", Name: "example.com"}, {Id: "z2", Name: "example.org"}}
+	recordsByZone := map[string][]DnsRecord{
+		"z1": {{Hostname: "my host.example.com", Type: "A", Value: "192.0.2.1"}},
+		"z2": {{Hostname: "www.example.org", Type: "A", Value: "192.0.2.2"}},
+	}
+
+	zoneFiles, errs := GenerateZoneFiles(zones, recordsByZone, nil, ZoneOptions{Strict: true})
+	if len(errs) != 1 || errs["example.com"] == nil {
+		t.Errorf("got errors %v, want one for example.com", errs)
+	}
+	if _, ok := zoneFiles["example.com"]; ok {
+		t.Error("got a zone file for the failed example.com")
+	}
+	if got := recordLines(t, zoneFiles["example.org"]); len(got) != 1 || got[0] != "www\tIN\tA\t192.0.2.2" {
+		t.Errorf("got record lines %q for example.org, want its A record", got)
+	}
+}
+
+func TestGenerateZoneFileCatchesCNAMEConflictsAcrossTrailingDots(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "www.example.com", Type: "CNAME", Value: "example.net"},
+		{Hostname: "WWW.example.com.", Type: "A", Value: "192.0.2.1"},
+	}
+
+	_, err := GenerateZoneFile(zone, records, nil, ZoneOptions{Strict: true})
+	var invalid validationError
+	if !errors.As(err, &invalid) || !strings.Contains(err.Error(), "www.example.com has a CNAME record along with A records") {
+		t.Errorf("got error %v with Strict, want the CNAME conflict of www.example.com", err)
+	}
+}
+
+func TestGenerateZoneFileWarnsAboutCNAMEConflicts(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "www.example.com", Type: "CNAME", Value: "example.net"},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1"},
+		{Hostname: "blog.example.com", Type: "CNAME", Value: "example.net"},
+	}
+
+	var logs bytes.Buffer
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{Logger: NewLogger(&logs, false, false)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recordLines(t, zoneFile); len(got) != 3 {
+		t.Errorf("got record lines %q, want all three records", got)
+	}
+	if strings.Count(logs.String(), "conflicting CNAME record") != 1 || !strings.Contains(logs.String(), "www.example.com") {
+		t.Errorf("want a single warning about www.example.com, got:\n%s", logs.String())
+	}
+
+	_, err = GenerateZoneFile(zone, records, nil, ZoneOptions{Strict: true})
+	var invalid validationError
+	if !errors.As(err, &invalid) {
+		t.Errorf("got error %v with Strict, want a validation error", err)
+	}
+}
+
+func TestResolveTokenFromNetlifyCLIConfig(t *testing.T) {
+	home := t.TempDir()
+	getenv := func(key string) string {
+		switch key {
+		case "HOME", "USERPROFILE", "APPDATA":
+			return home
+		}
+		return ""
+	}
+
+	if _, err := resolveToken("", "", true, getenv); err == nil {
+		t.Error("got no error without a Netlify CLI config")
+	}
+
+	configDir := filepath.Join(home, ".netlify")
+	if err := os.MkdirAll(configDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"userId": "u2", "users": {"u1": {"auth": {"token": "old-token"}}, "u2": {"auth": {"token": "cli-token"}}}}`
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := resolveToken("", "", true, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "cli-token" {
+		t.Errorf("got token %q, want that of the current CLI user", token)
+	}
+	if _, err := resolveToken("", "", false, getenv); err == nil {
+		t.Error("got no error with the CLI config but without useCLIAuth")
+	}
+
+	loggedOut := `{"userId": "", "users": {"u1": {"auth": {"token": "old-token"}}}}`
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(loggedOut), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveToken("", "", true, getenv); err == nil {
+		t.Error("got no error when no CLI user is logged in")
+	}
+}
+
+func TestGetAllDnsRecordsCapsRecords(t *testing.T) {
+	body := `[{"id": "r1", "hostname": "a.example.com", "type": "A", "value": "192.0.2.1"},
+		{"id": "r2", "hostname": "b.example.com", "type": "A", "value": "192.0.2.2"},
+		{"id": "r3", "hostname": "c.example.com", "type": "A", "value": "192.0.2.3"}]`
+
+	tests := []struct {
+		maxRecords int
+		wantErr    bool
+	}{
+		{2, true},
+		{3, false},
+		{0, false},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint("maxRecords=", test.maxRecords), func(t *testing.T) {
+			client := NewNetlifyDnsClient("token", WithTransport(&recordingTransport{body: body}), WithMaxRecords(test.maxRecords))
+			records, err := client.GetAllDnsRecords(context.Background(), "z1")
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "more than 2 records") {
+					t.Errorf("got error %v, want one about the cap", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 3 {
+				t.Errorf("got %d records, want 3", len(records))
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileWritesDSRecords(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	digest := "32996839A6D808AFE3EB4A795A0E6A7A39A76FC52FF228B22B76F6D63826F2B9"
+	want := "sub\tIN\tDS\t2371\t13\t2\t" + digest
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"single digest", "2371 13 2 " + digest, []string{want}},
+		{"split digest", "2371 13 2 " + digest[:32] + " " + digest[32:], []string{want}},
+		{"truncated digest", "2371 13 2 " + digest[:40], nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records := []DnsRecord{{Hostname: "sub.example.com", Type: "DS", Value: test.value, Ttl: 3600}}
+			zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{Strict: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got record lines %q, want %q", got, test.want)
+			}
+			if problems, err := ValidateZoneFile(zoneFile); err != nil || len(problems) != 0 {
+				t.Errorf("zone file does not validate: %v %v\n%s", problems, err, zoneFile)
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileWritesTLSARecords(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	hash := "8CB0FC6C527506A053F4F14C8464BEBBD6DEDE2738D11468DD953D7D6A3021F1"
+	records := []DnsRecord{
+		{Hostname: "_443._tcp.www.example.com", Type: "TLSA", Value: "3 1 1 " + hash, Ttl: 3600},
+		{Hostname: "_25._tcp.mail.example.com", Type: "TLSA", Value: "3 1 1 " + hash[:48] + " " + hash[48:], Ttl: 3600},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"_25._tcp.mail\tIN\tTLSA\t3\t1\t1\t" + hash,
+		"_443._tcp.www\tIN\tTLSA\t3\t1\t1\t" + hash,
+	}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+
+	invalid := []DnsRecord{{Hostname: "_443._tcp.www.example.com", Type: "TLSA", Value: "4 1 1 " + hash, Ttl: 3600}}
+	zoneFile, err = GenerateZoneFile(zone, invalid, nil, ZoneOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recordLines(t, zoneFile); len(got) != 0 {
+		t.Errorf("got record lines %q for a usage of 4 with Strict, want none", got)
+	}
+}
+
+func TestRunWithOptionsBuiltInCode(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{
+		OutDir:       dir,
+		FileNaming:   "id",
+		Zones:        []string{"example.com"},
+		IncludeTypes: []string{"CNAME"},
+		Ttl:          600,
+		NoTimestamp:  true,
+		Quiet:        true,
+	}
+	stdout, stderr, err := runZones(t, exampleFetcher(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "z1.zone")
+	if stdout != path+"\n" || stderr != "" {
+		t.Errorf("got stdout %q and stderr %q, want only %s on stdout", stdout, stderr, path)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), "$TTL 600\n") {
+		t.Errorf("zone file does not default to the 600 second TTL:\n%s", contents)
+	}
+	want := []string{"www\tIN\tCNAME\texample.com."}
+	if got := recordLines(t, string(contents)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
+
+func TestRunReportsProgress(t *testing.T) {
+	fetcher := exampleFetcher()
+	fetcher.Errors = map[string]error{"z2": errors.New("boom")}
+
+	_, stderr, err := runZones(t, fetcher, Options{Stdout: true, Progress: true, Concurrency: 1, NoTimestamp: true})
+	if err == nil {
+		t.Error("got no error for the failing zone")
+	}
+	for _, want := range []string{"[1/2] example.com: 2 records\n", "[2/2] example.org: failed\n"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr does not hold %q:\n%s", want, stderr)
+		}
+	}
+
+	_, stderr, _ = runZones(t, fetcher, Options{Stdout: true, Progress: true, Quiet: true, NoTimestamp: true})
+	if strings.Contains(stderr, "[1/2]") {
+		t.Errorf("got progress with Quiet:\n%s", stderr)
+	}
+}
+
+func TestRunOnlyRewritesZonesChangedSince(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{OutDir: dir, CacheDir: filepath.Join(dir, "cache"), NoTimestamp: true}
+	since := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	fetcher := exampleFetcher()
+	fetcher.Zones[0].UpdatedAt = since.Add(-time.Hour)
+	fetcher.Zones[1].UpdatedAt = since.Add(-time.Hour)
+	if _, _, err := runZones(t, fetcher, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both zones change, but Netlify only reports the update of example.com
+	fetcher.Records["z1"][0].Value = "192.0.2.10"
+	fetcher.Records["z2"][0].Value = "192.0.2.20"
+	fetcher.Zones[0].UpdatedAt = since.Add(time.Hour)
+	opts.Since = since
+	stdout, _, err := runZones(t, fetcher, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout != filepath.Join(dir, "example.com.zone")+"\n" {
+		t.Errorf("got stdout %q, want only example.com written", stdout)
+	}
+
+	com, err := os.ReadFile(filepath.Join(dir, "example.com.zone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(com), "192.0.2.10") {
+		t.Errorf("example.com was not rewritten:\n%s", com)
+	}
+	org, err := os.ReadFile(filepath.Join(dir, "example.org.zone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(org), "192.0.2.2\n") {
+		t.Errorf("example.org was rewritten:\n%s", org)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example.com.zone")
+	if err := os.WriteFile(path, []byte("old contents\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new contents\n")); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "new contents\n" {
+		t.Errorf("got contents %q, want the new ones", contents)
+	}
+
+	// Both modes are subject to the same umask
+	reference := filepath.Join(dir, "reference")
+	if err := os.WriteFile(reference, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	referenceInfo, err := os.Stat(reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != referenceInfo.Mode().Perm() {
+		t.Errorf("got mode %v, want %v", info.Mode().Perm(), referenceInfo.Mode().Perm())
+	}
+
+	// Renaming over a directory fails, which must not leave the temp file
+	subdir := filepath.Join(dir, "subdir")
+	if err := os.Mkdir(subdir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(subdir, []byte("contents\n")); err == nil {
+		t.Error("got no error writing over a directory")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temp file %s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestGenerateZoneFileCommentsRoundRobinGroups(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.3"},
+		{Hostname: "api.example.com", Type: "A", Value: "192.0.2.9"},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1"},
+		{Hostname: "www.example.com", Type: "AAAA", Value: "2001:db8::1"},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.2"},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "; 3 A records (round-robin)\n" +
+		"www\tIN\tA\t192.0.2.1\n" +
+		"www\tIN\tA\t192.0.2.2\n" +
+		"www\tIN\tA\t192.0.2.3\n"
+	if !strings.Contains(zoneFile, want) {
+		t.Errorf("zone file does not hold the commented group %q:\n%s", want, zoneFile)
+	}
+	if strings.Count(zoneFile, "round-robin") != 1 {
+		t.Errorf("want a single group comment, the api A and www AAAA records are alone:\n%s", zoneFile)
+	}
+}
+
+func TestGenerateZoneFileWritesClass(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "version.example.com", Type: "TXT", Value: "1.0"},
+		{Hostname: "www.example.com", Type: "A", Value: "192.0.2.1"},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{Class: "ch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"version\tCH\tTXT\t\"1.0\"", "www\tCH\tA\t192.0.2.1"}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+	if strings.Contains(zoneFile, "\tIN\t") {
+		t.Errorf("zone file still holds IN records:\n%s", zoneFile)
+	}
+
+	if _, err := GenerateZoneFile(zone, records, nil, ZoneOptions{Class: "XX"}); err == nil {
+		t.Error("got no error for an unknown class")
+	}
+	if _, _, err := runZones(t, exampleFetcher(), Options{Stdout: true, Class: "XX"}); ExitCode(err) != ExitUsage {
+		t.Errorf("got error %v from Run for an unknown class, want exit code %d", err, ExitUsage)
+	}
+}
+
+func TestRunTellsValidationAndNetworkFailuresApart(t *testing.T) {
+	invalid := func(fetcher *MemoryZoneFetcher) {
+		fetcher.Records["z1"] = append(fetcher.Records["z1"], DnsRecord{Hostname: "my host.example.com", Type: "A", Value: "192.0.2.9"})
+	}
+	unreachable := func(fetcher *MemoryZoneFetcher) {
+		fetcher.Errors = map[string]error{"z2": &APIError{StatusCode: http.StatusBadGateway, Endpoint: "dns_zones/z2/dns_records"}}
+	}
+
+	tests := []struct {
+		name    string
+		changes []func(*MemoryZoneFetcher)
+		want    int
+	}{
+		{"invalid zone", []func(*MemoryZoneFetcher){invalid}, ExitInvalid},
+		{"unreachable zone", []func(*MemoryZoneFetcher){unreachable}, ExitFailure},
+		{"both", []func(*MemoryZoneFetcher){invalid, unreachable}, ExitFailure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetcher := exampleFetcher()
+			for _, change := range test.changes {
+				change(fetcher)
+			}
+			_, _, err := runZones(t, fetcher, Options{OutDir: t.TempDir(), Strict: true})
+			if got := ExitCode(err); got != test.want {
+				t.Errorf("got error %v with exit code %d, want exit code %d", err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunWritesGzippedZoneFiles(t *testing.T) {
+	plainDir, gzipDir := t.TempDir(), t.TempDir()
+	if _, _, err := runZones(t, exampleFetcher(), Options{OutDir: plainDir, NoTimestamp: true}); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, err := runZones(t, exampleFetcher(), Options{OutDir: gzipDir, NoTimestamp: true, Gzip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(gzipDir, "example.com.zone.gz")
+	if !strings.HasPrefix(stdout, path+"\n") {
+		t.Errorf("got stdout %q, want %s first", stdout, path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := os.ReadFile(filepath.Join(plainDir, "example.com.zone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, plain) {
+		t.Errorf("decompressed zone file differs from the plain one:\n%s\nwant:\n%s", decompressed, plain)
+	}
+}
+
+func TestRunLogsExportSummary(t *testing.T) {
+	_, stderr, err := runZones(t, exampleFetcher(), Options{OutDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `msg="export summary" zones=2 records=3 types="A: 2, CNAME: 1"`
+	if !strings.Contains(stderr, want) {
+		t.Errorf("stderr does not hold %q:\n%s", want, stderr)
+	}
+
+	_, stderr, err = runZones(t, exampleFetcher(), Options{OutDir: t.TempDir(), Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stderr, "export summary") {
+		t.Errorf("got the summary with Quiet:\n%s", stderr)
+	}
+}
+
+func TestClientRejectsOversizedResponses(t *testing.T) {
+	body := `[{"id": "z1", "name": "example.com"}]`
+	tests := []struct {
+		maxBytes int64
+		wantErr  bool
+	}{
+		{int64(len(body)) - 1, true},
+		{int64(len(body)), false},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint("maxBytes=", test.maxBytes), func(t *testing.T) {
+			transport := &recordingTransport{body: body}
+			client := NewNetlifyDnsClient("token", WithTransport(transport), WithMaxResponseSize(test.maxBytes))
+
+			zones, err := client.GetAllDnsZones(context.Background())
+			if test.wantErr {
+				if !errors.Is(err, ErrResponseTooLarge) {
+					t.Errorf("got error %v, want ErrResponseTooLarge", err)
+				}
+				if len(transport.requests) != 1 {
+					t.Errorf("got %d requests, want the oversized response not to be retried", len(transport.requests))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(zones) != 1 {
+				t.Errorf("got zones %+v, want example.com", zones)
+			}
+		})
+	}
+}
+
+func TestGenerateZoneFileOnlyWritesPrioritiesOfMXAndSRV(t *testing.T) {
+	zone := DnsZone{Name: "example.com"}
+	records := []DnsRecord{
+		{Hostname: "example.com", Type: "A", Priority: 10, Value: "192.0.2.1"},
+		{Hostname: "example.com", Type: "MX", Priority: 10, Value: "mail.example.com"},
+		{Hostname: "example.com", Type: "TXT", Priority: 5, Value: "hello"},
+		{Hostname: "_sip._tcp.example.com", Type: "SRV", Priority: 20, Weight: intPtr(5), Port: intPtr(5060), Value: "sip.example.com"},
+		{Hostname: "www.example.com", Type: "CNAME", Priority: 10, Value: "example.com"},
+	}
+
+	zoneFile, err := GenerateZoneFile(zone, records, nil, ZoneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"@\tIN\tA\t192.0.2.1",
+		"@\tIN\tMX\t10\tmail.example.com.",
+		"@\tIN\tTXT\t\"hello\"",
+		"_sip._tcp\tIN\tSRV\t20\t5\t5060\tsip.example.com.",
+		"www\tIN\tCNAME\texample.com.",
+	}
+	if got := recordLines(t, zoneFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("got record lines %q, want %q", got, want)
+	}
+}
+
+func TestRunFailsEarlyForRejectedToken(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		http.Error(w, `{"code":403,"message":"Forbidden"}`, http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL))
+	err := client.CheckToken(context.Background())
+	if !errors.Is(err, ErrUnauthorized) || !strings.Contains(err.Error(), "lacks DNS scope") {
+		t.Errorf("got error %v, want ErrUnauthorized", err)
+	}
+
+	paths = nil
+	dir := t.TempDir()
+	err = Run(Options{Token: "token", APIURL: server.URL, OutDir: dir, Quiet: true}, RunEnv{
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		Getenv: func(string) string { return "" },
+	})
+	if !errors.Is(err, ErrUnauthorized) || ExitCode(err) != ExitFailure {
+		t.Errorf("got error %v with exit code %d, want ErrUnauthorized and exit code %d", err, ExitCode(err), ExitFailure)
+	}
+	if want := []string{"/dns_zones?per_page=1"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got requests %q, want the preflight check alone", paths)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("got %d files in the output directory, want none", len(entries))
+	}
+}
+
+func TestRunSkipsUnchangedZoneFiles(t *testing.T) {
+	dir := t.TempDir()
+	fetcher := exampleFetcher()
+	if _, _, err := runZones(t, fetcher, Options{OutDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Backdating the files shows whether they are rewritten
+	past := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"example.com.zone", "example.org.zone"} {
+		if err := os.Chtimes(filepath.Join(dir, name), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, stderr, err := runZones(t, fetcher, Options{OutDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout != "" {
+		t.Errorf("got stdout %q, want no file written", stdout)
+	}
+	if strings.Count(stderr, "msg=unchanged") != 2 {
+		t.Errorf("stderr does not report both files unchanged:\n%s", stderr)
+	}
+	for _, name := range []string{"example.com.zone", "example.org.zone"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(past) {
+			t.Errorf("%s was rewritten at %v", name, info.ModTime())
+		}
+	}
+
+	fetcher.Records["z2"][0].Value = "192.0.2.20"
+	stdout, _, err = runZones(t, fetcher, Options{OutDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "example.org.zone") + "\n"; stdout != want {
+		t.Errorf("got stdout %q, want only the changed %q", stdout, want)
+	}
+}
+
+func TestRunWritesMetricsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "netlify.prom")
+	if _, _, err := runZones(t, exampleFetcher(), Options{OutDir: dir, MetricsPath: path}); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE netlify_dns_zone_file_zones_total gauge\nnetlify_dns_zone_file_zones_total 2\n",
+		"netlify_dns_zone_file_records_total 3\n",
+		"netlify_dns_zone_file_export_duration_seconds ",
+		"netlify_dns_zone_file_last_success_timestamp_seconds ",
+	} {
+		if !strings.Contains(string(metrics), want) {
+			t.Errorf("metrics do not hold %q:\n%s", want, metrics)
+		}
+	}
+	succeeded := lastSuccess(path)
+	if succeeded.IsZero() {
+		t.Fatalf("no last success time in:\n%s", metrics)
+	}
+
+	// A failed run keeps the time of the last successful one
+	if _, _, err := runZones(t, &failingFetcher{}, Options{OutDir: dir, MetricsPath: path}); err == nil {
+		t.Fatal("got no error for the failing run")
+	}
+	metrics, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(metrics), "netlify_dns_zone_file_zones_total 0\n") {
+		t.Errorf("metrics of the failed run do not count zero zones:\n%s", metrics)
+	}
+	if got := lastSuccess(path); !got.Equal(succeeded) {
+		t.Errorf("got last success %v after a failed run, want %v", got, succeeded)
+	}
+}
+
+func TestClientSendsPerPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		perPage int
+		want    string
+	}{
+		{"default", 0, strconv.Itoa(defaultPerPage)},
+		{"set", 25, "25"},
+		{"capped", maxPerPage + 1, strconv.Itoa(maxPerPage)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &recordingTransport{body: `[]`}
+			client := NewNetlifyDnsClient("token", WithTransport(transport), WithPerPage(test.perPage))
+
+			if _, err := client.GetAllDnsRecords(context.Background(), "z1"); err != nil {
+				t.Fatal(err)
+			}
+			if len(transport.requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(transport.requests))
+			}
+			if got := transport.requests[0].URL.Query().Get("per_page"); got != test.want {
+				t.Errorf("got per_page %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// installNamedCheckzone puts a named-checkzone running script first on
+// the PATH for the rest of the test
+func installNamedCheckzone(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the named-checkzone stand-in is a shell script")
+	}
+
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, namedCheckzone), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+}
+
+func TestRunChecksZoneFilesWithNamedCheckzone(t *testing.T) {
+	// The stand-in accepts example.com and rejects example.org, failing for
+	// an empty zone file too
+	installNamedCheckzone(t, `#!/bin/sh
+[ -s "$2" ] || { echo "$2: file not found"; exit 1; }
+if [ "$1" = "example.org" ]; then
+	echo "zone $1/IN: has 0 SOA records"
+	exit 1
+fi
+echo "zone $1/IN: loaded serial 1"
+echo OK
+`)
+
+	dir := t.TempDir()
+	_, stderr, err := runZones(t, exampleFetcher(), Options{OutDir: dir, Check: true})
+	if ExitCode(err) != ExitInvalid || !strings.Contains(err.Error(), "has 0 SOA records") {
+		t.Errorf("got error %v with exit code %d, want the rejection of example.org and exit code %d", err, ExitCode(err), ExitInvalid)
+	}
+	if !strings.Contains(stderr, namedCheckzone+" passed") || !strings.Contains(stderr, "loaded serial 1") {
+		t.Errorf("stderr does not report example.com passing:\n%s", stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "example.com.zone")); err != nil {
+		t.Errorf("example.com was not written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "example.org.zone")); err == nil {
+		t.Error("the rejected example.org was written")
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	_, stderr, err = runZones(t, exampleFetcher(), Options{OutDir: t.TempDir(), Check: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr, namedCheckzone+" not found") {
+		t.Errorf("stderr does not warn about the missing tool:\n%s", stderr)
+	}
+}
+
+func TestRunChecksCloudflareZoneFilesWithTheirSOA(t *testing.T) {
+	// Like the real named-checkzone, the stand-in rejects zones without an
+	// SOA record
+	installNamedCheckzone(t, `#!/bin/sh
+while read -r line; do
+	case "$line" in
+	*"	SOA	"*) echo "zone $1/IN: loaded serial 1"; echo OK; exit 0 ;;
+	esac
+done < "$2"
+echo "zone $1/IN: has 0 SOA records"
+exit 1
+`)
+
+	for _, format := range []string{FormatBind, FormatCloudflare} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			_, stderr, err := runZones(t, exampleFetcher(), Options{OutDir: dir, Format: format, Check: true})
+			if err != nil {
+				t.Fatalf("got error %v, stderr:\n%s", err, stderr)
+			}
+			if strings.Count(stderr, namedCheckzone+" passed") != 2 {
+				t.Errorf("stderr does not report both zones passing:\n%s", stderr)
+			}
+
+			contents, err := os.ReadFile(filepath.Join(dir, "example.com.zone"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hasSOA := strings.Contains(string(contents), "\tSOA\t"); hasSOA != (format == FormatBind) {
+				t.Errorf("%s zone file has an SOA record: %v, want %v:\n%s", format, hasSOA, format == FormatBind, contents)
+			}
+		})
+	}
+}
+
+func TestApiErrorsNameEndpointWithoutQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Get("per_page") == "1":
+			http.Error(w, `{"code":401,"message":"nope"}`, http.StatusUnauthorized)
+		case r.URL.Query().Get("page") == "2":
+			http.Error(w, `{"code":500,"message":"nope"}`, http.StatusInternalServerError)
+		default:
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s/api/v1/dns_zones?page=2&per_page=100>; rel="next"`, r.Host))
+			fmt.Fprint(w, `[{"id": "z1", "name": "example.com"}]`)
+		}
+	}))
+	defer server.Close()
+	client := NewNetlifyDnsClient("token", WithBaseURL(server.URL+"/api/v1"), WithRetries(1, time.Millisecond))
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"token check", func() error { return client.CheckToken(context.Background()) }},
+		{"later page", func() error {
+			_, err := client.GetAllDnsZones(context.Background())
+			return err
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var apiErr *APIError
+			if err := test.call(); !errors.As(err, &apiErr) {
+				t.Fatalf("got error %v, want an APIError", err)
+			}
+			if apiErr.Endpoint != "dns_zones" {
+				t.Errorf("got endpoint %q, want dns_zones", apiErr.Endpoint)
+			}
+		})
+	}
+}